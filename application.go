@@ -1,101 +1,311 @@
 package application
 
 import (
+	"context"
+	"expvar"
+	"fmt"
 	"github.com/carbocation/interpose"
 	gorilla_mux "github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
-	"github.com/sendgrid/sendgrid-go"
-	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/viper"
+	"log/slog"
 	"net/http"
 	"os"
 	"time"
 
 	"github.com/jpatrickpark/server1/handlers"
+	"github.com/jpatrickpark/server1/links"
+	"github.com/jpatrickpark/server1/metrics"
 	"github.com/jpatrickpark/server1/middlewares"
 	"github.com/jpatrickpark/server1/models"
+	"github.com/jpatrickpark/server1/notify"
+	"github.com/jpatrickpark/server1/rules"
+	"github.com/jpatrickpark/server1/sessionstore"
+	"github.com/jpatrickpark/server1/websoc"
 )
 
-func ReadableStatus(newStatus int) string {
-	switch newStatus {
-	case models.FULL: //             = 0
-		return "is full"
-	case models.OPEN: //             = 1
-		return "is open"
-	case models.WAITLIST: //         = 2
-		return "has open waitlist"
-	case models.NONEXISTENT: //      = 3
-		return "does not exist"
-	case models.DELETED: //          = 4
-		return "is successfully deleted"
-	case models.ENTRYEXISTS: //      = 5
-		return "is already recorded"
-	case models.NOTDELETED: //       = 6
-		return "is not deleted"
-	case models.NEWONLY_FULL: //     = 7
-		return "is only available for new students"
-	case models.NEWONLY_WAITLIST: // = 8
-		return "has an open waitlist for current students"
-	default:
-		return "encountered an unknown error"
+// staleCourses is the number of courses that were not checked successfully within models.StaleAfter
+// as of the last poll cycle.
+var staleCourses = expvar.NewInt("stale_courses")
+
+// PollerOptions controls how often users are notified of a course that keeps changing.
+type PollerOptions struct {
+	// Cooldown is the least time between two notifications of the same kind about a course to a user.
+	Cooldown time.Duration
+	// Hysteresis is the number of checks in a row a new status must be seen before it is recorded.
+	Hysteresis int
+	// Logger records the checks and notifications, with the ID of the poll cycle.
+	Logger *slog.Logger
+}
+
+// PollerOptionsFromConfig reads notify_cooldown and notify_hysteresis from the config, and the logger as LoggerFromConfig does.
+func PollerOptionsFromConfig(config *viper.Viper) PollerOptions {
+	config.SetDefault("notify_cooldown", "30m")
+	config.SetDefault("notify_hysteresis", 1)
+
+	options := PollerOptions{
+		Cooldown:   config.GetDuration("notify_cooldown"),
+		Hysteresis: config.GetInt("notify_hysteresis"),
+		Logger:     LoggerFromConfig(config).With("job", "poller"),
+	}
+	if options.Hysteresis < 1 {
+		options.Hysteresis = 1
 	}
+	return options
 }
 
-func SendCourseOpenEmail(courseCode, quarter, email string, newStatus int) {
-	stringStatus := ReadableStatus(newStatus)
-	from := mail.NewEmail("My UCI Class Is Full", "myuciclassisfull@gmail.com")
-	to := mail.NewEmail(email, email)
-	title := "Your course " + courseCode + " " + stringStatus + "!"
-	content := "<p>Your course " + courseCode + " for " + handlers.ReadableQuarter(quarter) + " quarter " + stringStatus + "!</p><p>Go ahead and enroll in now on <a href='https://www.reg.uci.edu'>Webreg</a>!</p>"
-	newContent := mail.NewContent("text/html", content)
-	message := mail.NewV3MailInit(from, title, to, newContent)
-	message.AddCategories("CourseAlert")
-	request := sendgrid.GetRequest(os.Getenv("SENDGRID_API_KEY"), "/v3/mail/send", "https://api.sendgrid.com")
-	request.Method = "POST"
-	request.Body = mail.GetRequestBody(message)
-	// I should think more about what to do when the email fails to send.
-	sendgrid.API(request)
+// SendCourseOpenEmail notifies the user of the alert in the user's locale.
+func SendCourseOpenEmail(email, locale string, alert notify.Alert) error {
+	message, err := notify.RenderAlert(locale, alert)
+	if err != nil {
+		return err
+	}
+	return notify.Send(email, "CourseAlert", message)
 }
-func SendToAccordingUsers(db *sqlx.DB, courseId int64, courseCode, quarter string, newStatus int) {
-	if newStatus != models.OPEN && newStatus != models.WAITLIST && newStatus != models.NEWONLY_WAITLIST {
-		return
+
+// receivesAlerts returns nil if the user of the settings is sent course alerts now,
+// or an error wrapping handlers.ErrNotNotifiable that tells why not.
+func receivesAlerts(settings *models.UserSettings) error {
+	switch {
+	case !settings.Verified:
+		// Alerts are held back until the user proves to receive mail at the address
+		return fmt.Errorf("%w: the address is not verified", handlers.ErrNotNotifiable)
+	case settings.Undeliverable:
+		// Mail to the address bounced, so the user has to fix it first
+		return fmt.Errorf("%w: mail to the address bounced", handlers.ErrNotNotifiable)
+	case settings.DeletionRequestedAt != nil:
+		return fmt.Errorf("%w: the account is being deleted", handlers.ErrNotNotifiable)
+	case settings.UnsubscribedAt != nil:
+		return fmt.Errorf("%w: the user unsubscribed", handlers.ErrNotNotifiable)
+	case settings.Digest:
+		// Users in digest mode hear of the change in their next daily digest
+		return fmt.Errorf("%w: the user receives daily digests", handlers.ErrNotNotifiable)
 	}
+	return nil
+}
+
+// SendToAccordingUsers notifies the users watching the course of the change from old to new.
+// episode is when the current status of the course was recorded, so a user is notified of each kind of change at most once per episode,
+// and not again within cooldown of the last notification of that kind.
+func SendToAccordingUsers(db *sqlx.DB, courseId int64, courseCode, quarter string, old, new models.Snapshot, episode time.Time, cooldown time.Duration, logger *slog.Logger) {
+	// Every watch has its own rule, so each user is notified of the most important event their rule triggers
 	pair := models.NewUserCoursePair(db)
 	userStruct := models.NewUser(db)
+	notification := models.NewNotification(db)
+	logger = logger.With("course_id", courseId, "course_code", courseCode, "quarter", quarter)
 	pairs, err1 := pair.GetPairsByCourseId(nil, courseId)
-	if err1 == nil {
+	if err1 != nil {
+		logger.Error("notify: failed to look up watchers", "err", err1)
+	} else {
 		for _, item := range *pairs {
+			if item.IsSnoozed(time.Now()) {
+				continue
+			}
+			events := rules.Evaluate(item.WatchRule, old, new)
+			if len(events) == 0 {
+				continue
+			}
+			event := events[0]
+			last, err := notification.LastCreatedAt(nil, item.UserID, courseId, event.Kind)
+			if err != nil {
+				logger.Error("notify: failed to look up notifications", "user_id", item.UserID, "err", err)
+				continue
+			}
+			if last != nil && time.Since(*last) < cooldown {
+				continue
+			}
 			user, err2 := userStruct.GetById(nil, item.UserID)
-			if err2 == nil {
-				SendCourseOpenEmail(courseCode, quarter, user.Email, newStatus)
+			if err2 != nil {
+				logger.Error("notify: failed to look up user", "user_id", item.UserID, "err", err2)
+				continue
+			}
+			settings, err := userStruct.GetSettings(nil, item.UserID)
+			if err != nil {
+				logger.Error("notify: failed to look up settings", "user_id", item.UserID, "err", err)
+				continue
+			}
+			if receivesAlerts(settings) != nil {
+				continue
+			}
+			claimed, err := notification.Claim(nil, item.UserID, courseId, event.Kind, event.Status, event.SeatsAvailable, episode)
+			if err != nil {
+				logger.Error("notify: failed to record notification", "user_id", item.UserID, "err", err)
+				continue
+			}
+			if claimed == nil {
+				// Another check already notified the user of this episode
+				continue
+			}
+			alert := notify.Alert{
+				UserID:     item.UserID,
+				CourseID:   courseId,
+				CourseCode: courseCode,
+				Quarter:    quarter,
+				Event:      event,
+				Section:    new.Section,
+			}
+			if err = SendCourseOpenEmail(user.Email, notify.UserLocale(settings), alert); err != nil {
+				logger.Error("notify: failed to send notification", "user_id", item.UserID, "notification_id", claimed.ID, "err", err)
+				err = notification.MarkFailed(nil, claimed.ID, err)
+			} else {
+				err = notification.MarkSent(nil, claimed.ID)
+			}
+			if err != nil {
+				logger.Error("notify: failed to record delivery", "user_id", item.UserID, "notification_id", claimed.ID, "err", err)
 			}
 		}
 	}
 }
-func My_uci_class_is_full(db *sqlx.DB) {
+func My_uci_class_is_full(db *sqlx.DB, options PollerOptions) {
 	for {
 		course := models.NewCourse(db)
-		courses, err := course.AllCourses(nil)
-		if err == nil {
-			now := time.Now()
-			//now = time.Date(2016, time.March, 10, 23, 0, 0, 0, time.UTC)
-			possibleQuarters := handlers.PossibleQuarters(now)
+		now := time.Now()
+		//now = time.Date(2016, time.March, 10, 23, 0, 0, 0, time.UTC)
+		// Every record of the cycle carries its ID, so a slow or failing cycle can be followed through the logs
+		logger := options.Logger.With("cycle_id", middlewares.NewCorrelationID())
+		handlers.RecordPollerHeartbeat(now)
+		courses, err := course.ActiveCourses(nil, handlers.PossibleQuarters(now))
+		if err != nil {
+			logger.Error("poller: failed to look up active courses", "err", err)
+		} else {
+			var stale int64
+			failures := 0
 			for _, item := range courses {
-				if handlers.Contains(possibleQuarters, item.Quarter) {
-					newStatus := handlers.CourseStatus(item.Quarter, item.CourseCode)
-					if item.Status != newStatus {
-						course.UpdateCourse(nil, item.ID, newStatus)
-						if (item.Status == models.FULL || item.Status == models.NEWONLY_FULL) && (newStatus == models.OPEN || newStatus == models.WAITLIST || newStatus == models.NEWONLY_WAITLIST) {
-							go SendToAccordingUsers(db, item.ID, item.CourseCode, item.Quarter, newStatus)
-						}
+				courseLogger := logger.With("course_id", item.ID, "course_code", item.CourseCode, "quarter", item.Quarter)
+				snapshot, err := handlers.CachedCourseSnapshot(item.Quarter, item.CourseCode)
+				if err != nil {
+					// Keep the previous status so that an outage does not look like a transition
+					courseLogger.Warn("poller: failed to check course", "err", err)
+				} else if err = checkCourse(db, item, snapshot, now, options, logger); err != nil {
+					courseLogger.Error("poller: failed to record status of course", "err", err)
+				}
+				if err != nil {
+					metrics.CoursesChecked.WithLabelValues("failed").Inc()
+					failures++
+					if item.IsStale(now) {
+						courseLogger.Warn("poller: course is stale", "last_checked_at", item.LastCheckedAt)
+						stale++
 					}
+				} else {
+					metrics.CoursesChecked.WithLabelValues("ok").Inc()
 				}
 			}
+			staleCourses.Set(stale)
+			metrics.PollCycleDuration.Observe(time.Since(now).Seconds())
+			handlers.RecordPollerCycle(now, len(courses), failures, stale)
+			logger.Info("poller: checked courses", "courses", len(courses), "failures", failures, "stale", stale, "duration", time.Since(now))
+		}
+		time.Sleep(models.PollInterval)
+	}
+}
+
+// checkCourse records the snapshot of the course taken at now and notifies its users of the change, if any.
+// When it fails, the transition is seen again by the next check, so nobody is notified until it is recorded.
+// logger is the logger of the poll cycle or recheck.
+func checkCourse(db *sqlx.DB, item *models.CourseRow, snapshot models.Snapshot, now time.Time, options PollerOptions, logger *slog.Logger) error {
+	course := models.NewCourse(db)
+	var episode time.Time
+	if item.LastChangedAt != nil {
+		episode = *item.LastChangedAt
+	}
+
+	if item.Status == snapshot.Status {
+		if err := course.TouchCourse(nil, item.ID, snapshot); err != nil {
+			return err
 		}
-		time.Sleep(time.Minute)
+	} else {
+		// A new status is only recorded once it has been seen for options.Hysteresis checks in a row
+		checks := 1
+		if item.PendingStatus != nil && *item.PendingStatus == snapshot.Status {
+			checks = item.PendingChecks + 1
+		}
+		if checks < options.Hysteresis {
+			return course.DeferCourse(nil, item.ID, snapshot, checks)
+		}
+		episode = now
+		if err := course.UpdateCourse(nil, item.ID, snapshot, episode); err != nil {
+			return err
+		}
+		metrics.StatusTransitions.WithLabelValues(models.StatusCode(item.Status), models.StatusCode(snapshot.Status)).Inc()
+	}
+
+	old := item.Snapshot()
+	if old.Status != snapshot.Status || old.SeatsAvailable() != snapshot.SeatsAvailable() {
+		go SendToAccordingUsers(db, item.ID, item.CourseCode, item.Quarter, old, snapshot, episode, options.Cooldown, logger)
 	}
+	return nil
+}
+
+// RecheckCourse checks the course of the ID on WebSoc now, bypassing the status cache, as one check of the poller would.
+func RecheckCourse(db *sqlx.DB, courseId int64, options PollerOptions) error {
+	item, err := models.NewCourse(db).GetCourseById(nil, courseId)
+	if err != nil {
+		return err
+	}
+	snapshot, err := handlers.RefreshCourseSnapshot(item.Quarter, item.CourseCode)
+	if err != nil {
+		return err
+	}
+	return checkCourse(db, item, snapshot, time.Now(), options, options.Logger.With("recheck_id", middlewares.NewCorrelationID()))
+}
+
+// ResendNotification sends the notification of the ID again, whether or not it was delivered before, and records the delivery.
+// It refuses with handlers.ErrNotNotifiable to mail users the poller would not alert now.
+// The email shows the WebSoc row of the course as it is now, since the row of the original alert is not kept.
+func ResendNotification(db *sqlx.DB, notificationId int64, logger *slog.Logger) error {
+	notification := models.NewNotification(db)
+	record, err := notification.GetOutboxRecordById(nil, notificationId)
+	if err != nil {
+		return err
+	}
+	settings, err := models.NewUser(db).GetSettings(nil, record.UserID)
+	if err != nil {
+		return err
+	}
+	if err := receivesAlerts(settings); err != nil {
+		return err
+	}
+
+	alert := notify.Alert{
+		UserID:     record.UserID,
+		CourseID:   record.CourseID,
+		CourseCode: record.CourseCode,
+		Quarter:    record.Quarter,
+		Event:      rules.Event{Kind: record.Kind, Status: record.Status, SeatsAvailable: record.Seats},
+	}
+	if snapshot, err := handlers.CachedCourseSnapshot(record.Quarter, record.CourseCode); err != nil {
+		logger.Warn("notify: failed to look up the course for a resend", "notification_id", record.ID, "err", err)
+	} else {
+		alert.Section = snapshot.Section
+	}
+	if sendErr := SendCourseOpenEmail(record.Email, notify.UserLocale(settings), alert); sendErr != nil {
+		if err = notification.MarkFailed(nil, record.ID, sendErr); err != nil {
+			logger.Error("notify: failed to record delivery", "notification_id", record.ID, "err", err)
+		}
+		return sendErr
+	}
+	return notification.MarkSent(nil, record.ID)
+}
+
+// LoggerFromConfig returns the structured logger set by log_format, "json" or "text", and log_level,
+// "debug", "info", "warn" or "error".
+func LoggerFromConfig(config *viper.Viper) *slog.Logger {
+	config.SetDefault("log_format", "json")
+	config.SetDefault("log_level", "info")
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(config.GetString("log_level"))); err != nil {
+		level = slog.LevelInfo
+	}
+	handlerOptions := &slog.HandlerOptions{Level: level}
+	if config.GetString("log_format") == "text" {
+		return slog.New(slog.NewTextHandler(os.Stderr, handlerOptions))
+	}
+	return slog.New(slog.NewJSONHandler(os.Stderr, handlerOptions))
 }
 
 // New is the constructor for Application struct.
@@ -109,11 +319,46 @@ func New(config *viper.Viper) (*Application, error) {
 
 	cookieStoreSecret := config.Get("cookie_secret").(string)
 
+	if userAgent := config.GetString("websoc_user_agent"); userAgent != "" {
+		websoc.Default.SetUserAgent(userAgent)
+	}
+
+	links.Default, err = links.New(config.GetString("public_url"), []byte(config.GetString("link_secret")))
+	if err != nil {
+		return nil, err
+	}
+
 	app := &Application{}
+	app.logger = LoggerFromConfig(config)
+	// The log package and the background jobs started without options log through the same handler
+	slog.SetDefault(app.logger)
 	app.config = config
 	app.dsn = dsn
 	app.db = db
-	app.sessionStore = sessions.NewCookieStore([]byte(cookieStoreSecret))
+	app.pollerOptions = PollerOptionsFromConfig(config)
+
+	// The gauges of this app's database are kept apart from the package metrics, so that New can be called again
+	app.metricsRegistry = prometheus.NewRegistry()
+	err = app.metricsRegistry.Register(metrics.NewWatchesCollector(func() (map[string]int64, error) {
+		quarters, err := models.NewCourse(db).WatchesByQuarter(nil)
+		watches := make(map[string]int64, len(quarters))
+		for _, quarter := range quarters {
+			watches[quarter.Quarter] = quarter.Watches
+		}
+		return watches, err
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	app.sessionStore = sessionstore.New(db, []byte(cookieStoreSecret))
+
+	if issuer := config.GetString("oidc_issuer"); issuer != "" {
+		app.oidcLogin, err = handlers.NewOIDCLogin(context.Background(), issuer, config.GetString("oidc_client_id"), config.GetString("oidc_client_secret"), config.GetString("public_url")+"/login/oidc/callback")
+		if err != nil {
+			return nil, err
+		}
+	}
 	return app, err
 }
 
@@ -123,20 +368,37 @@ type Application struct {
 	dsn          string
 	db           *sqlx.DB
 	sessionStore sessions.Store
+	logger       *slog.Logger
+	// oidcLogin is nil unless oidc_issuer is set in the config.
+	oidcLogin *handlers.OIDCLogin
+	// pollerOptions are the options rechecks from the admin dashboard check courses with.
+	pollerOptions PollerOptions
+	// metricsRegistry holds the metrics of the database, served at /metrics with those of package metrics.
+	metricsRegistry *prometheus.Registry
 }
 
 func (app *Application) MiddlewareStruct() (*interpose.Middleware, error) {
+	router := app.mux()
 	middle := interpose.New()
+	middle.Use(middlewares.RequestID)
+	middle.Use(middlewares.SetLogger(app.logger, router))
 	middle.Use(middlewares.SetDB(app.db))
 	middle.Use(middlewares.SetSessionStore(app.sessionStore))
-
-	middle.UseHandler(app.mux())
+	middle.Use(middlewares.SetCurrentUser)
+	// Requests refused by CSRF are counted too
+	middle.Use(middlewares.Metrics(router))
+	// The login and signup forms carry no token, links from emails confirm with a POST from mail clients,
+	// SendGrid signs its events, and probes need no session
+	middle.Use(middlewares.CSRF([]string{"/login", "/signup"}, "/my-uci-class-is-full/links/", "/sendgrid/events", "/healthz", "/readyz"))
+	middle.UseHandler(router)
 
 	return middle, nil
 }
 
 func (app *Application) mux() *gorilla_mux.Router {
 	MustLogin := middlewares.MustLogin
+	MustAdmin := middlewares.MustAdmin(app.config.GetStringSlice("admin_emails"))
+	MustBeUserOrAdmin := middlewares.MustBeUserOrAdmin(app.config.GetStringSlice("admin_emails"))
 
 	router := gorilla_mux.NewRouter()
 
@@ -149,6 +411,11 @@ func (app *Application) mux() *gorilla_mux.Router {
 	router.HandleFunc("/login", handlers.GetLogin).Methods("GET")
 	router.HandleFunc("/login", handlers.PostLogin).Methods("POST")
 	router.HandleFunc("/logout", handlers.GetLogout).Methods("GET")
+	router.Handle("/logout/everywhere", MustLogin(http.HandlerFunc(handlers.PostLogoutEverywhere))).Methods("POST")
+	if app.oidcLogin != nil {
+		router.HandleFunc("/login/oidc", app.oidcLogin.GetLogin).Methods("GET")
+		router.HandleFunc("/login/oidc/callback", app.oidcLogin.GetCallback).Methods("GET")
+	}
 	router.HandleFunc("/search-golang/intersectRepo", handlers.PostIntersectRepo).Methods("Post")
 	router.HandleFunc("/search-golang/intersectHuman", handlers.PostIntersectHuman).Methods("Post")
 	router.HandleFunc("/search-golang/search", handlers.GetSearch).Methods("GET")
@@ -156,7 +423,39 @@ func (app *Application) mux() *gorilla_mux.Router {
 	router.Handle("/my-uci-class-is-full/term/{quarter}", MustLogin(http.HandlerFunc(handlers.PutTerm))).Methods("PUT")
 	router.Handle("/my-uci-class-is-full/term/{quarter}/{courseCode}", MustLogin(http.HandlerFunc(handlers.DeleteTerm))).Methods("DELETE")
 	router.Handle("/my-uci-class-is-full/term/{quarter}", MustLogin(http.HandlerFunc(handlers.GetTerm))).Methods("GET")
-	router.Handle("/users/{id:[0-9]+}", MustLogin(http.HandlerFunc(handlers.PostPutDeleteUsersID))).Methods("POST", "PUT", "DELETE")
+	router.Handle("/my-uci-class-is-full/term/{quarter}/courses", MustLogin(http.HandlerFunc(handlers.GetTermCourses))).Methods("GET")
+	router.Handle("/my-uci-class-is-full/term/{quarter}/{courseCode}/rule", MustLogin(http.HandlerFunc(handlers.PutTermRule))).Methods("PUT")
+	router.Handle("/my-uci-class-is-full/subscription", MustLogin(http.HandlerFunc(handlers.PutSubscription))).Methods("PUT")
+	router.Handle("/my-uci-class-is-full/email-status", MustLogin(http.HandlerFunc(handlers.GetEmailStatus))).Methods("GET")
+	router.Handle("/my-uci-class-is-full/email-status", MustLogin(http.HandlerFunc(handlers.DeleteEmailStatus))).Methods("DELETE")
+	router.Handle("/my-uci-class-is-full/account/export", MustLogin(http.HandlerFunc(handlers.GetAccountExport))).Methods("GET")
+	router.Handle("/my-uci-class-is-full/account/deletion", MustLogin(http.HandlerFunc(handlers.PostAccountDeletion))).Methods("POST")
+	router.Handle("/my-uci-class-is-full/account/deletion", MustLogin(http.HandlerFunc(handlers.DeleteAccountDeletion))).Methods("DELETE")
+	router.Handle("/sendgrid/events", handlers.PostSendGridEvents(app.config.GetString("sendgrid_webhook_public_key"))).Methods("POST")
+	router.Handle("/my-uci-class-is-full/verification", MustLogin(http.HandlerFunc(handlers.PostVerification))).Methods("POST")
+	router.HandleFunc("/verify-email/{token}", handlers.GetVerifyEmail).Methods("GET")
+	router.HandleFunc("/forgot-password", handlers.GetForgotPassword).Methods("GET")
+	router.HandleFunc("/forgot-password", handlers.PostForgotPassword).Methods("POST")
+	router.HandleFunc("/reset-password/{token}", handlers.GetResetPassword).Methods("GET")
+	router.HandleFunc("/reset-password/{token}", handlers.PostResetPassword).Methods("POST")
+	router.Handle("/my-uci-class-is-full/digest", MustLogin(http.HandlerFunc(handlers.PutDigest))).Methods("PUT")
+	router.Handle("/my-uci-class-is-full/locale", MustLogin(http.HandlerFunc(handlers.PutLocale))).Methods("PUT")
+	router.HandleFunc("/my-uci-class-is-full/links/{token}", handlers.GetLink).Methods("GET")
+	router.HandleFunc("/my-uci-class-is-full/links/{token}", handlers.PostLink).Methods("POST")
+	router.Handle("/users/{id:[0-9]+}", MustLogin(MustBeUserOrAdmin(http.HandlerFunc(handlers.PostPutDeleteUsersID)))).Methods("POST", "PUT", "DELETE")
+	router.Handle("/debug/vars", MustLogin(MustAdmin(expvar.Handler()))).Methods("GET")
+	router.Handle("/metrics", middlewares.MustBearerToken(app.config.GetString("metrics_token"))(
+		promhttp.HandlerFor(prometheus.Gatherers{prometheus.DefaultGatherer, app.metricsRegistry}, promhttp.HandlerOpts{}))).Methods("GET")
+	router.HandleFunc("/healthz", handlers.GetHealthz).Methods("GET")
+	router.HandleFunc("/readyz", handlers.GetReadyz).Methods("GET")
+	router.Handle("/admin", MustLogin(MustAdmin(http.HandlerFunc(handlers.GetAdmin)))).Methods("GET")
+	router.Handle("/admin/notifications/preview", MustLogin(MustAdmin(http.HandlerFunc(handlers.GetNotificationPreview)))).Methods("GET")
+	router.Handle("/admin/courses/{id:[0-9]+}/recheck", MustLogin(MustAdmin(handlers.PostAdminRecheck(func(courseId int64) error {
+		return RecheckCourse(app.db, courseId, app.pollerOptions)
+	})))).Methods("POST")
+	router.Handle("/admin/notifications/{id:[0-9]+}/resend", MustLogin(MustAdmin(handlers.PostAdminResend(func(notificationId int64) error {
+		return ResendNotification(app.db, notificationId, app.logger)
+	})))).Methods("POST")
 
 	// Path of static files must be last!
 	router.PathPrefix("/").Handler(http.FileServer(http.Dir("static")))
@@ -0,0 +1,62 @@
+// Package bounces finds out which addresses do not receive the notification emails.
+//
+// SendGrid reports bounces and spam complaints to an event webhook, and mail servers report them
+// to the bounce mailbox as delivery status notifications (RFC 3464) and feedback reports (RFC 5965).
+// Both are turned into Events, and Apply pauses the alerts of the users they name.
+package bounces
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/jpatrickpark/server1/models"
+)
+
+// Kinds of events.
+const (
+	// Bounce means mail to the address failed permanently.
+	Bounce = "bounce"
+	// Complaint means the recipient marked a message as spam.
+	Complaint = "complaint"
+)
+
+// Event is a report that an address does not want or cannot receive mail.
+type Event struct {
+	Email  string
+	Kind   string
+	Reason string
+}
+
+// Apply marks the addresses of bounces as undeliverable and unsubscribes the users who complained.
+// Both stop their alerts until they fix their address or subscribe again.
+func Apply(db *sqlx.DB, events []Event, logger *slog.Logger) error {
+	userStruct := models.NewUser(db)
+	for _, event := range events {
+		email := strings.TrimSpace(event.Email)
+		if email == "" {
+			continue
+		}
+		var updated int64
+		var err error
+		switch event.Kind {
+		case Bounce:
+			updated, err = userStruct.MarkUndeliverable(nil, email, event.Reason)
+		case Complaint:
+			updated, err = userStruct.UnsubscribeByEmail(nil, email)
+		default:
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		logger.Info("bounces: applied event", "kind", event.Kind, "domain", domain(email), "reason", event.Reason, "users", updated)
+	}
+	return nil
+}
+
+// domain returns the domain of the address, so that logs do not keep whole addresses.
+func domain(email string) string {
+	return email[strings.LastIndex(email, "@")+1:]
+}
@@ -0,0 +1,104 @@
+package bounces
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// ParseReport returns the bounces and complaints in a message of the bounce mailbox.
+// Delivery status notifications count as bounces for recipients whose delivery failed with a permanent 5.x.x status,
+// and feedback reports count as complaints. Other messages, such as out of office replies, have no events.
+func ParseReport(r io.Reader) ([]Event, error) {
+	message, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/report" {
+		return nil, nil
+	}
+
+	var events []Event
+	parts := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return events, err
+		}
+		switch strings.ToLower(strings.Split(part.Header.Get("Content-Type"), ";")[0]) {
+		case "message/delivery-status":
+			bounces, err := parseDeliveryStatus(part)
+			if err != nil {
+				return events, err
+			}
+			events = append(events, bounces...)
+		case "message/feedback-report":
+			complaint, err := parseFeedbackReport(part)
+			if err != nil {
+				return events, err
+			}
+			if complaint != nil {
+				events = append(events, *complaint)
+			}
+		}
+	}
+}
+
+// parseDeliveryStatus reads the per-message fields and then the per-recipient fields of RFC 3464, which are separated by blank lines.
+func parseDeliveryStatus(r io.Reader) ([]Event, error) {
+	reader := textproto.NewReader(bufio.NewReader(r))
+	if _, err := reader.ReadMIMEHeader(); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	var events []Event
+	for {
+		fields, err := reader.ReadMIMEHeader()
+		if len(fields) > 0 && strings.EqualFold(fields.Get("Action"), "failed") && strings.HasPrefix(strings.TrimSpace(fields.Get("Status")), "5") {
+			reason := fields.Get("Diagnostic-Code")
+			if reason == "" {
+				reason = fields.Get("Status")
+			}
+			events = append(events, Event{Email: address(fields.Get("Final-Recipient")), Kind: Bounce, Reason: reason})
+		}
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return events, err
+		}
+	}
+}
+
+// parseFeedbackReport reads the fields of an RFC 5965 feedback report, and returns nil for reports that are not complaints.
+func parseFeedbackReport(r io.Reader) (*Event, error) {
+	fields, err := textproto.NewReader(bufio.NewReader(r)).ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !strings.EqualFold(fields.Get("Feedback-Type"), "abuse") {
+		return nil, nil
+	}
+	// Original-Rcpt-To is optional, so reports without it cannot be matched to a user
+	email := fields.Get("Original-Rcpt-To")
+	if email == "" {
+		return nil, nil
+	}
+	return &Event{Email: address(email), Kind: Complaint, Reason: "abuse report"}, nil
+}
+
+// address strips the address type of fields such as "rfc822; user@example.com".
+func address(field string) string {
+	if i := strings.Index(field, ";"); i >= 0 {
+		field = field[i+1:]
+	}
+	return strings.Trim(strings.TrimSpace(field), "<>")
+}
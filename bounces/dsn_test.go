@@ -0,0 +1,39 @@
+package bounces
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseReport(t *testing.T) {
+	tests := []struct {
+		message string
+		want    []Event
+	}{
+		// Only the recipient whose delivery failed permanently bounced; the delayed one may still get the message
+		{"dsn.eml", []Event{
+			{Email: "gone@uci.edu", Kind: Bounce, Reason: "smtp; 550 5.1.1 <gone@uci.edu>: Recipient address rejected: User unknown"},
+		}},
+		{"arf.eml", []Event{
+			{Email: "student@uci.edu", Kind: Complaint, Reason: "abuse report"},
+		}},
+		{"autoreply.eml", nil},
+	}
+	for _, test := range tests {
+		message, err := os.Open(filepath.Join("testdata", test.message))
+		if err != nil {
+			t.Fatal(err)
+		}
+		events, err := ParseReport(message)
+		message.Close()
+		if err != nil {
+			t.Errorf("%v: ParseReport returned %v", test.message, err)
+			continue
+		}
+		if !reflect.DeepEqual(events, test.want) {
+			t.Errorf("%v: ParseReport = %+v; want %+v", test.message, events, test.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package bounces
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// maxTimestampSkew is how far the signed timestamp of an event webhook request may be from now.
+const maxTimestampSkew = 5 * time.Minute
+
+var (
+	// ErrInvalidSignature is returned by VerifySendGridSignature for requests that were not signed by SendGrid.
+	ErrInvalidSignature = errors.New("bounces: invalid event webhook signature")
+	// ErrStaleTimestamp is returned by VerifySendGridSignature for signed requests that are too old, such as replayed ones.
+	ErrStaleTimestamp = errors.New("bounces: event webhook timestamp is too old or in the future")
+)
+
+// sendGridEvent is an event of the SendGrid event webhook. Other fields are ignored.
+type sendGridEvent struct {
+	Email  string `json:"email"`
+	Event  string `json:"event"`
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// ParseSendGridEvents returns the bounces and complaints in the body of an event webhook request.
+// Temporary failures, which SendGrid reports as bounces of type "blocked", are left out.
+func ParseSendGridEvents(body []byte) ([]Event, error) {
+	var sendGridEvents []sendGridEvent
+	if err := json.Unmarshal(body, &sendGridEvents); err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	for _, e := range sendGridEvents {
+		switch {
+		case e.Event == "bounce" && e.Type != "blocked":
+			events = append(events, Event{Email: e.Email, Kind: Bounce, Reason: e.Reason})
+		case e.Event == "dropped" && e.Reason == "Bounced Address":
+			events = append(events, Event{Email: e.Email, Kind: Bounce, Reason: e.Reason})
+		case e.Event == "spamreport", e.Event == "dropped" && e.Reason == "Spam Reporting Address":
+			events = append(events, Event{Email: e.Email, Kind: Complaint, Reason: e.Reason})
+		}
+	}
+	return events, nil
+}
+
+// VerifySendGridSignature checks the signature of a signed event webhook request.
+// publicKey is the base64 verification key shown in the SendGrid settings, and signature and timestamp are the
+// X-Twilio-Email-Event-Webhook-Signature and X-Twilio-Email-Event-Webhook-Timestamp headers.
+// The timestamp, in Unix seconds, is signed with the body and must be within maxTimestampSkew of now,
+// so that a captured request cannot be replayed later.
+func VerifySendGridSignature(publicKey, signature, timestamp string, body []byte, now time.Time) error {
+	der, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return err
+	}
+	ecdsaKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return errors.New("bounces: event webhook verification key is not an ECDSA key")
+	}
+
+	decodedSignature, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	hash := sha256.Sum256(append([]byte(timestamp), body...))
+	if !ecdsa.VerifyASN1(ecdsaKey, hash[:], decodedSignature) {
+		return ErrInvalidSignature
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrStaleTimestamp
+	}
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > maxTimestampSkew || skew < -maxTimestampSkew {
+		return ErrStaleTimestamp
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package bounces
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// signedRequest returns the verification key of a new key pair and the signature of the body at the timestamp.
+func signedRequest(t *testing.T, timestamp string, body []byte) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256(append([]byte(timestamp), body...))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(der), base64.StdEncoding.EncodeToString(signature)
+}
+
+func TestVerifySendGridSignature(t *testing.T) {
+	body := []byte(`[{"email":"student@uci.edu","event":"bounce","type":"bounce"}]`)
+	now := time.Now()
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	publicKey, signature := signedRequest(t, timestamp, body)
+
+	if err := VerifySendGridSignature(publicKey, signature, timestamp, body, now); err != nil {
+		t.Errorf("VerifySendGridSignature of a signed request returned %v", err)
+	}
+	if err := VerifySendGridSignature(publicKey, signature, timestamp, append(body, ' '), now); err != ErrInvalidSignature {
+		t.Errorf("VerifySendGridSignature of an altered body returned %v; want ErrInvalidSignature", err)
+	}
+	if err := VerifySendGridSignature(publicKey, signature, strconv.FormatInt(now.Unix()+1, 10), body, now); err != ErrInvalidSignature {
+		t.Errorf("VerifySendGridSignature of an altered timestamp returned %v; want ErrInvalidSignature", err)
+	}
+	if err := VerifySendGridSignature(publicKey, signature, timestamp, body, now.Add(time.Hour)); err != ErrStaleTimestamp {
+		t.Errorf("VerifySendGridSignature of a replayed request returned %v; want ErrStaleTimestamp", err)
+	}
+	if err := VerifySendGridSignature(publicKey, signature, timestamp, body, now.Add(-time.Hour)); err != ErrStaleTimestamp {
+		t.Errorf("VerifySendGridSignature of a request from the future returned %v; want ErrStaleTimestamp", err)
+	}
+}
+
+func TestParseSendGridEvents(t *testing.T) {
+	body, err := ioutil.ReadFile(filepath.Join("testdata", "sendgrid_events.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := ParseSendGridEvents(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Deliveries, opens and temporary failures are left out
+	want := []Event{
+		{Email: "gone@uci.edu", Kind: Bounce, Reason: "550 5.1.1 The email account that you tried to reach does not exist."},
+		{Email: "old@uci.edu", Kind: Bounce, Reason: "Bounced Address"},
+		{Email: "angry@uci.edu", Kind: Complaint, Reason: "Spam Reporting Address"},
+		{Email: "spam@uci.edu", Kind: Complaint},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("ParseSendGridEvents = %+v; want %+v", events, want)
+	}
+}
@@ -0,0 +1,42 @@
+// Command dsn reads a message of the bounce mailbox from standard input and pauses the alerts
+// of the addresses it reports as bouncing or complaining.
+//
+// Deliver the bounce mailbox to it from the mail server, for example with a Postfix alias:
+//
+//	bounces: "|/usr/local/bin/dsn -dsn postgres://..."
+//
+// Messages that are not delivery status notifications or feedback reports are ignored.
+package main
+
+import (
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+
+	"github.com/jpatrickpark/server1/bounces"
+)
+
+func main() {
+	dsn := flag.String("dsn", os.Getenv("DSN"), "PostgreSQL connection string of the app")
+	flag.Parse()
+
+	events, err := bounces.ParseReport(os.Stdin)
+	if err != nil {
+		log.Fatalf("dsn: failed to parse message: %v", err)
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	db, err := sqlx.Connect("postgres", *dsn)
+	if err != nil {
+		log.Fatalf("dsn: failed to connect to the database: %v", err)
+	}
+	if err := bounces.Apply(db, events, slog.Default()); err != nil {
+		log.Fatalf("dsn: failed to record events: %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+// Command genstatus generates the status constants shared by the Go code and uci.js.
+//
+// It writes models/status_gen.go and templates/status.js.tmpl; run it with go generate ./models.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"text/template"
+)
+
+type status struct {
+	Name       string
+	Value      int
+	Code       string
+	HTTPStatus int
+	Message    string
+}
+
+// statuses is the single source of the statuses of courses and of PUT/DELETE term requests.
+// Values are stored in the database, so never change or reuse one.
+var statuses = []status{
+	{"FULL", 0, "full", http.StatusCreated, "The course is full."},
+	{"OPEN", 1, "open", http.StatusCreated, "The course is open."},
+	{"WAITLIST", 2, "waitlist", http.StatusCreated, "The course has an open waitlist."},
+	{"NONEXISTENT", 3, "nonexistent", http.StatusNotFound, "The course does not exist."},
+	{"DELETED", 4, "deleted", http.StatusOK, "The course is no longer watched."},
+	{"ENTRYEXISTS", 5, "entry_exists", http.StatusConflict, "The course is already watched."},
+	{"NOTDELETED", 6, "not_watched", http.StatusNotFound, "The course is not watched."},
+	{"NEWONLY_FULL", 7, "newonly_full", http.StatusCreated, "The course is only available for new students."},
+	{"NEWONLY_WAITLIST", 8, "newonly_waitlist", http.StatusCreated, "The course has an open waitlist for current students."},
+	{"INVALID", 9, "invalid_request", http.StatusUnprocessableEntity, "The course code or the quarter is not valid."},
+	{"UNKNOWN", 10, "registrar_unavailable", http.StatusBadGateway, "The status of the course could not be fetched from WebSoc."},
+}
+
+var goTemplate = template.Must(template.New("go").Parse(`// Code generated by cmd/genstatus; DO NOT EDIT.
+
+package models
+
+const (
+{{- range .}}
+	{{.Name}} = {{.Value}}
+{{- end}}
+)
+
+var statusCodes = map[int]string{
+{{- range .}}
+	{{.Name}}: {{printf "%q" .Code}},
+{{- end}}
+}
+
+var statusHTTPStatuses = map[int]int{
+{{- range .}}
+	{{.Name}}: {{.HTTPStatus}},
+{{- end}}
+}
+
+var statusMessages = map[int]string{
+{{- range .}}
+	{{.Name}}: {{printf "%q" .Message}},
+{{- end}}
+}
+`))
+
+var jsTemplate = template.Must(template.New("js").Delims("[[", "]]").Parse(`{{/* Code generated by cmd/genstatus; DO NOT EDIT. */}}
+{{define "status"}}
+[[- range .]]
+    [[.Name]] = [[.Value]];
+[[- end]]
+{{end}}
+`))
+
+func main() {
+	goOut := flag.String("go", "status_gen.go", "path of the generated Go file")
+	jsOut := flag.String("js", "../templates/status.js.tmpl", "path of the generated JavaScript template")
+	flag.Parse()
+
+	var goBuffer bytes.Buffer
+	if err := goTemplate.Execute(&goBuffer, statuses); err != nil {
+		log.Fatal(err)
+	}
+	goSource, err := format.Source(goBuffer.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(*goOut, goSource, 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	var jsBuffer bytes.Buffer
+	if err := jsTemplate.Execute(&jsBuffer, statuses); err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(*jsOut, jsBuffer.Bytes(), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
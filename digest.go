@@ -0,0 +1,111 @@
+package application
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+	"log/slog"
+	"time"
+
+	"github.com/jpatrickpark/server1/handlers"
+	"github.com/jpatrickpark/server1/middlewares"
+	"github.com/jpatrickpark/server1/models"
+	"github.com/jpatrickpark/server1/notify"
+)
+
+const (
+	// digestPeriod is how far back the changes listed in a digest go.
+	digestPeriod = 24 * time.Hour
+	// digestMinInterval is the least time between two digests to a user, so a restart does not send a second one.
+	digestMinInterval = 20 * time.Hour
+)
+
+// DigestOptions controls when daily digests are sent.
+type DigestOptions struct {
+	// Hour is the hour of the day digests are sent at in Location.
+	Hour     int
+	Location *time.Location
+	// Logger records the digests sent, with the ID of the run.
+	Logger *slog.Logger
+}
+
+// DigestOptionsFromConfig reads digest_hour and digest_timezone from the config, and the logger as LoggerFromConfig does.
+func DigestOptionsFromConfig(config *viper.Viper) DigestOptions {
+	config.SetDefault("digest_hour", 7)
+	config.SetDefault("digest_timezone", "America/Los_Angeles")
+
+	options := DigestOptions{Hour: config.GetInt("digest_hour"), Location: time.Local, Logger: LoggerFromConfig(config).With("job", "digest")}
+	location, err := time.LoadLocation(config.GetString("digest_timezone"))
+	if err != nil {
+		options.Logger.Warn("digest: unknown digest_timezone", "digest_timezone", config.GetString("digest_timezone"), "using", options.Location.String(), "err", err)
+	} else {
+		options.Location = location
+	}
+	return options
+}
+
+// next returns the first time digests are due after now.
+func (o DigestOptions) next(now time.Time) time.Time {
+	local := now.In(o.Location)
+	next := time.Date(local.Year(), local.Month(), local.Day(), o.Hour, 0, 0, 0, o.Location)
+	if !next.After(now) {
+		next = time.Date(local.Year(), local.Month(), local.Day()+1, o.Hour, 0, 0, 0, o.Location)
+	}
+	return next
+}
+
+// SendDigests sends every user in digest mode a summary of their courses once a day at the configured hour.
+func SendDigests(db *sqlx.DB, options DigestOptions) {
+	for {
+		now := time.Now()
+		time.Sleep(options.next(now).Sub(now))
+		sendDigests(db, time.Now(), options)
+	}
+}
+
+func sendDigests(db *sqlx.DB, now time.Time, options DigestOptions) {
+	logger := options.Logger.With("run_id", middlewares.NewCorrelationID())
+	userStruct := models.NewUser(db)
+	recipients, err := userStruct.DigestRecipients(nil, now.Add(-digestMinInterval))
+	if err != nil {
+		logger.Error("digest: failed to look up recipients", "err", err)
+		return
+	}
+
+	course := models.NewCourse(db)
+	history := models.NewStatusHistory(db)
+	var sent int
+	for _, recipient := range recipients {
+		digest := notify.Digest{UserID: recipient.ID, Location: options.Location}
+		for _, quarter := range handlers.PossibleQuarters(now) {
+			courses, err := course.GetCoursesByUserIdAndQuarter(nil, recipient.ID, quarter)
+			if err != nil {
+				logger.Error("digest: failed to look up courses", "user_id", recipient.ID, "quarter", quarter, "err", err)
+				continue
+			}
+			digest.Courses = append(digest.Courses, *courses...)
+		}
+		if len(digest.Courses) == 0 {
+			continue
+		}
+		digest.Changes, err = history.ChangesSinceByUserId(nil, recipient.ID, now.Add(-digestPeriod))
+		if err != nil {
+			logger.Error("digest: failed to look up changes", "user_id", recipient.ID, "err", err)
+			continue
+		}
+
+		message, err := notify.RenderDigest(notify.UserLocale(&recipient.UserSettings), digest)
+		if err != nil {
+			logger.Error("digest: failed to render digest", "user_id", recipient.ID, "err", err)
+			continue
+		}
+		if err = notify.Send(recipient.Email, "Digest", message); err != nil {
+			logger.Error("digest: failed to send digest", "user_id", recipient.ID, "err", err)
+			continue
+		}
+		if err = userStruct.MarkDigestSent(nil, recipient.ID, now); err != nil {
+			logger.Error("digest: failed to record digest", "user_id", recipient.ID, "err", err)
+		}
+		sent++
+	}
+	logger.Info("digest: sent digests", "digests", sent)
+}
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/jpatrickpark/server1/links"
+	"github.com/jpatrickpark/server1/models"
+	"github.com/jpatrickpark/server1/notify"
+)
+
+const (
+	// verificationTTL is how long a verification link works. A new one is sent when the user visits the app after it expires.
+	verificationTTL = 48 * time.Hour
+	// verificationResendAfter is the least time between two verification emails the user asks for.
+	verificationResendAfter = time.Minute
+	// resetPasswordTTL is how long a password reset link works.
+	resetPasswordTTL = time.Hour
+	// resetPasswordResendAfter is the least time between two password reset emails to an account,
+	// as anyone can ask for them without signing in.
+	resetPasswordResendAfter = time.Minute
+)
+
+// VerificationResponse is the answer to POST /my-uci-class-is-full/verification.
+type VerificationResponse struct {
+	Sent bool `json:"sent"`
+}
+
+// SendVerificationEmail sends the user a link that verifies the current address of the user.
+func SendVerificationEmail(db *sqlx.DB, user *models.UserRow, locale string) error {
+	token, err := models.NewEmailToken(db).CreateToken(nil, user.ID, user.Email, models.VerifyEmailPurpose, verificationTTL)
+	if err != nil {
+		return err
+	}
+	message, err := notify.RenderAccountEmail(notify.VerifyEmail, locale, links.Default.Absolute("/verify-email/"+token))
+	if err != nil {
+		return err
+	}
+	return notify.Send(user.Email, "Account", message)
+}
+
+// sendVerificationEmailIfNeeded sends a verification email unless a link sent to the current address of the user still works.
+// It is how new users and users who changed their address get one, as both land on the app afterwards.
+func sendVerificationEmailIfNeeded(db *sqlx.DB, user *models.UserRow, locale string) error {
+	last, err := models.NewEmailToken(db).LastCreatedAt(nil, user.ID, user.Email, models.VerifyEmailPurpose)
+	if err != nil {
+		return err
+	}
+	if last != nil && time.Since(*last) < verificationTTL {
+		return nil
+	}
+	return SendVerificationEmail(db, user, locale)
+}
+
+func PostVerification(w http.ResponseWriter, r *http.Request) {
+	// Send the user another verification email
+	w.Header().Set("Content-Type", "application/json")
+	currentUser := getCurrentUser(w, r)
+	if currentUser == nil {
+		http.Redirect(w, r, "/logout", 302)
+		return
+	}
+
+	db := context.Get(r, "db").(*sqlx.DB)
+
+	response := VerificationResponse{}
+	last, err := models.NewEmailToken(db).LastCreatedAt(nil, currentUser.ID, currentUser.Email, models.VerifyEmailPurpose)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	if last != nil && time.Since(*last) < verificationResendAfter {
+		w.WriteHeader(429)
+	} else {
+		locale, err := UserLocale(db, currentUser.ID)
+		if err != nil {
+			handleError(w, r, err)
+			return
+		}
+		if err := SendVerificationEmail(db, currentUser, locale); err != nil {
+			handleError(w, r, err)
+			return
+		}
+		response.Sent = true
+	}
+
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	w.Write(jsonResponse)
+}
+
+func GetVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	// Verify the address a verification link was sent to, whoever is signed in
+	db := context.Get(r, "db").(*sqlx.DB)
+
+	emailToken, err := models.NewEmailToken(db).UseToken(nil, mux.Vars(r)["token"], models.VerifyEmailPurpose)
+	if err == sql.ErrNoRows {
+		writeLinkPage(w, r, http.StatusGone, notify.DefaultLocale, "landing.expired")
+		return
+	}
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	locale, err := UserLocale(db, emailToken.UserID)
+	if err != nil {
+		getLogger(r).Warn("account: failed to look up locale", "user_id", emailToken.UserID, "err", err)
+		locale = notify.DefaultLocale
+	}
+	verified, err := models.NewUser(db).VerifyEmail(nil, emailToken.UserID, emailToken.Email)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	if !verified {
+		writeLinkPage(w, r, http.StatusConflict, locale, "landing.verify.changed")
+		return
+	}
+	writeLinkPage(w, r, http.StatusOK, locale, "landing.verify.done")
+}
+
+// passwordPage is what templates/forgot_password.html.tmpl and templates/reset_password.html.tmpl are executed with.
+type passwordPage struct {
+	Message   string
+	Error     string
+	CSRFToken string
+}
+
+func GetForgotPassword(w http.ResponseWriter, r *http.Request) {
+	// Ask for the address of the account whose password is forgotten
+	renderPasswordPage(w, r, http.StatusOK, "templates/forgot_password.html.tmpl", passwordPage{})
+}
+
+func PostForgotPassword(w http.ResponseWriter, r *http.Request) {
+	// Send a password reset link to the address if it belongs to an account
+	// The answer is the same either way so that it does not tell which addresses have accounts
+	db := context.Get(r, "db").(*sqlx.DB)
+	email := r.FormValue("Email")
+
+	user, err := models.NewUser(db).GetByEmail(nil, email)
+	if err == nil {
+		err = sendPasswordResetEmail(db, user)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		getLogger(r).Error("account: failed to send password reset email", "err", err)
+	}
+
+	renderPasswordPage(w, r, http.StatusOK, "templates/forgot_password.html.tmpl", passwordPage{
+		Message: "If an account uses " + email + ", we sent it a link to reset its password. The link works for an hour.",
+	})
+}
+
+// sendPasswordResetEmail sends the user a password reset link, unless one was sent within resetPasswordResendAfter
+// or mail to the address bounced, so that the form cannot be used to flood an address.
+func sendPasswordResetEmail(db *sqlx.DB, user *models.UserRow) error {
+	last, err := models.NewEmailToken(db).LastCreatedAt(nil, user.ID, user.Email, models.ResetPasswordPurpose)
+	if err != nil {
+		return err
+	}
+	if last != nil && time.Since(*last) < resetPasswordResendAfter {
+		return nil
+	}
+	settings, err := models.NewUser(db).GetSettings(nil, user.ID)
+	if err != nil {
+		return err
+	}
+	if settings.Undeliverable {
+		return nil
+	}
+
+	token, err := models.NewEmailToken(db).CreateToken(nil, user.ID, user.Email, models.ResetPasswordPurpose, resetPasswordTTL)
+	if err != nil {
+		return err
+	}
+	locale, err := UserLocale(db, user.ID)
+	if err != nil {
+		locale = notify.DefaultLocale
+	}
+	message, err := notify.RenderAccountEmail(notify.ResetPassword, locale, links.Default.Absolute("/reset-password/"+token))
+	if err != nil {
+		return err
+	}
+	return notify.Send(user.Email, "Account", message)
+}
+
+func GetResetPassword(w http.ResponseWriter, r *http.Request) {
+	// Ask for a new password if the reset link still works
+	db := context.Get(r, "db").(*sqlx.DB)
+
+	_, err := models.NewEmailToken(db).GetValidToken(nil, mux.Vars(r)["token"], models.ResetPasswordPurpose)
+	if err == sql.ErrNoRows {
+		writeLinkPage(w, r, http.StatusGone, notify.DefaultLocale, "landing.expired")
+		return
+	}
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	renderPasswordPage(w, r, http.StatusOK, "templates/reset_password.html.tmpl", passwordPage{})
+}
+
+func PostResetPassword(w http.ResponseWriter, r *http.Request) {
+	// Set the new password of the account the reset link was sent for
+	db := context.Get(r, "db").(*sqlx.DB)
+	password := r.FormValue("Password")
+	passwordAgain := r.FormValue("PasswordAgain")
+
+	// Check the passwords before using up the link, so that a typo does not need a new link
+	if password == "" || password != passwordAgain {
+		renderPasswordPage(w, r, 422, "templates/reset_password.html.tmpl", passwordPage{Error: "The passwords are empty or do not match."})
+		return
+	}
+
+	emailToken, err := models.NewEmailToken(db).UseToken(nil, mux.Vars(r)["token"], models.ResetPasswordPurpose)
+	if err == sql.ErrNoRows {
+		writeLinkPage(w, r, http.StatusGone, notify.DefaultLocale, "landing.expired")
+		return
+	}
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	userStruct := models.NewUser(db)
+	user, err := userStruct.GetById(nil, emailToken.UserID)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	locale, err := UserLocale(db, user.ID)
+	if err != nil {
+		getLogger(r).Warn("account: failed to look up locale", "user_id", user.ID, "err", err)
+		locale = notify.DefaultLocale
+	}
+	// A link sent to an address the account no longer uses must not take it over
+	if user.Email != emailToken.Email {
+		writeLinkPage(w, r, http.StatusConflict, locale, "landing.verify.changed")
+		return
+	}
+
+	if _, err = userStruct.UpdateEmailAndPasswordById(nil, user.ID, user.Email, password, passwordAgain); err != nil {
+		handleError(w, r, err)
+		return
+	}
+	// Following the link proves the address receives mail
+	if _, err = userStruct.VerifyEmail(nil, user.ID, emailToken.Email); err != nil {
+		handleError(w, r, err)
+		return
+	}
+	// Whoever knew the old password must not stay signed in
+	if _, err = models.NewSession(db).DeleteSessionsByUserId(nil, user.ID); err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	writeLinkPage(w, r, http.StatusOK, locale, "landing.reset.done")
+}
+
+func PostLogoutEverywhere(w http.ResponseWriter, r *http.Request) {
+	// Sign the user out of every browser by deleting all of their sessions
+	db := context.Get(r, "db").(*sqlx.DB)
+	sessionStore := context.Get(r, "sessionStore").(sessions.Store)
+
+	currentUser := getCurrentUser(w, r)
+	if currentUser == nil {
+		http.Redirect(w, r, "/logout", 302)
+		return
+	}
+
+	if _, err := models.NewSession(db).DeleteSessionsByUserId(nil, currentUser.ID); err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	// Also clear this browser's cookie, which is all there is to revoke with the cookie session store
+	session, _ := sessionStore.Get(r, "server1-session")
+	delete(session.Values, "user")
+	session.Options.MaxAge = -1
+	if err := session.Save(r, w); err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/login", 302)
+}
+
+func renderPasswordPage(w http.ResponseWriter, r *http.Request, httpStatus int, file string, page passwordPage) {
+	page.CSRFToken = getCSRFToken(r)
+	tmpl, err := template.ParseFiles(file)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(httpStatus)
+	if err = tmpl.Execute(w, page); err != nil {
+		getLogger(r).Error("failed to render template", "template", file, "err", err)
+	}
+}
@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/context"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/jpatrickpark/server1/models"
+	"github.com/jpatrickpark/server1/notify"
+)
+
+// AccountExport is everything stored about a user, as answered to GET /my-uci-class-is-full/account/export.
+// Password hashes, session IDs and token hashes are not exported.
+type AccountExport struct {
+	ExportedAt    time.Time                   `json:"exportedAt"`
+	User          ExportedUser                `json:"user"`
+	Watches       []models.Watch              `json:"watches"`
+	Notifications []models.NotificationRecord `json:"notifications"`
+	Sessions      []models.SessionRecord      `json:"sessions"`
+	EmailTokens   []models.EmailTokenRecord   `json:"emailTokens"`
+}
+
+// ExportedUser is the account and settings of the user in an AccountExport.
+type ExportedUser struct {
+	ID                  int64      `json:"id"`
+	Email               string     `json:"email"`
+	Locale              string     `json:"locale"`
+	UnsubscribedAt      *time.Time `json:"unsubscribedAt"`
+	Digest              bool       `json:"digest"`
+	DigestSentAt        *time.Time `json:"digestSentAt"`
+	Verified            bool       `json:"verified"`
+	Undeliverable       bool       `json:"undeliverable"`
+	UndeliverableReason string     `json:"undeliverableReason"`
+	DeletionRequestedAt *time.Time `json:"deletionRequestedAt"`
+}
+
+// AccountDeletionResponse is the answer to POST and DELETE /my-uci-class-is-full/account/deletion.
+type AccountDeletionResponse struct {
+	// DeletionScheduledFor is when the account will be deleted, and is nil unless its deletion is pending.
+	DeletionScheduledFor *time.Time `json:"deletionScheduledFor"`
+}
+
+// deletionScheduledFor returns when the account of a user who asked to delete it at requestedAt will be deleted.
+func deletionScheduledFor(requestedAt *time.Time) *time.Time {
+	if requestedAt == nil {
+		return nil
+	}
+	scheduledFor := requestedAt.Add(models.AccountDeletionGrace)
+	return &scheduledFor
+}
+
+// exportAccount collects everything stored about the user.
+func exportAccount(db *sqlx.DB, user *models.UserRow) (*AccountExport, error) {
+	settings, err := models.NewUser(db).GetSettings(nil, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	watches, err := models.NewUserCoursePair(db).GetWatchesByUserId(nil, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	notifications, err := models.NewNotification(db).GetNotificationsByUserId(nil, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := models.NewSession(db).GetSessionsByUserId(nil, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	emailTokens, err := models.NewEmailToken(db).GetEmailTokensByUserId(nil, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AccountExport{
+		ExportedAt: time.Now(),
+		User: ExportedUser{
+			ID:                  user.ID,
+			Email:               user.Email,
+			Locale:              notify.UserLocale(settings),
+			UnsubscribedAt:      settings.UnsubscribedAt,
+			Digest:              settings.Digest,
+			DigestSentAt:        settings.DigestSentAt,
+			Verified:            settings.Verified,
+			Undeliverable:       settings.Undeliverable,
+			UndeliverableReason: settings.UndeliverableReason.String,
+			DeletionRequestedAt: settings.DeletionRequestedAt,
+		},
+		Watches:       watches,
+		Notifications: notifications,
+		Sessions:      sessions,
+		EmailTokens:   emailTokens,
+	}, nil
+}
+
+func GetAccountExport(w http.ResponseWriter, r *http.Request) {
+	// Download everything stored about the user, as JSON or with format=csv as a zip file of CSV files
+	currentUser := getCurrentUser(w, r)
+	if currentUser == nil {
+		http.Redirect(w, r, "/logout", 302)
+		return
+	}
+
+	db := context.Get(r, "db").(*sqlx.DB)
+
+	export, err := exportAccount(db, currentUser)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	if r.FormValue("format") == "csv" {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="my-uci-class-is-full.zip"`)
+		if err = writeAccountExportCSV(w, export); err != nil {
+			handleError(w, r, err)
+		}
+		return
+	}
+
+	jsonResponse, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="my-uci-class-is-full.json"`)
+	w.Write(jsonResponse)
+}
+
+// writeAccountExportCSV writes the export as a zip file of user.csv, watches.csv, notifications.csv, sessions.csv and email_tokens.csv.
+func writeAccountExportCSV(w http.ResponseWriter, export *AccountExport) error {
+	archive := zip.NewWriter(w)
+
+	user := export.User
+	err := writeCSVFile(archive, "user.csv",
+		[]string{"id", "email", "locale", "unsubscribed_at", "digest", "digest_sent_at", "verified", "undeliverable", "undeliverable_reason", "deletion_requested_at"},
+		[][]string{{
+			strconv.FormatInt(user.ID, 10), user.Email, user.Locale, formatCSVTime(user.UnsubscribedAt), strconv.FormatBool(user.Digest), formatCSVTime(user.DigestSentAt),
+			strconv.FormatBool(user.Verified), strconv.FormatBool(user.Undeliverable), user.UndeliverableReason, formatCSVTime(user.DeletionRequestedAt),
+		}})
+	if err != nil {
+		return err
+	}
+
+	watches := [][]string{}
+	for _, watch := range export.Watches {
+		statuses := make([]string, len(watch.Statuses))
+		for i, status := range watch.Statuses {
+			statuses[i] = strconv.FormatInt(status, 10)
+		}
+		watches = append(watches, []string{
+			watch.Quarter, watch.CourseCode, strconv.Itoa(watch.Status), formatCSVTime(watch.SnoozedUntil),
+			strings.Join(statuses, " "), strconv.Itoa(watch.MinSeats), strconv.FormatBool(watch.Waitlist), strconv.FormatBool(watch.Closed),
+		})
+	}
+	err = writeCSVFile(archive, "watches.csv",
+		[]string{"quarter", "course_code", "course_status", "snoozed_until", "notify_statuses", "min_seats", "notify_waitlist", "notify_closed"},
+		watches)
+	if err != nil {
+		return err
+	}
+
+	notifications := [][]string{}
+	for _, notification := range export.Notifications {
+		notifications = append(notifications, []string{
+			strconv.FormatInt(notification.ID, 10), notification.Quarter, notification.CourseCode, notification.Kind, strconv.Itoa(notification.Status),
+			strconv.Itoa(notification.Seats), formatCSVTime(&notification.CreatedAt), formatCSVTime(notification.SentAt),
+		})
+	}
+	err = writeCSVFile(archive, "notifications.csv",
+		[]string{"id", "quarter", "course_code", "kind", "status", "seats", "created_at", "sent_at"},
+		notifications)
+	if err != nil {
+		return err
+	}
+
+	sessions := [][]string{}
+	for _, session := range export.Sessions {
+		sessions = append(sessions, []string{formatCSVTime(&session.CreatedAt), formatCSVTime(&session.UpdatedAt), formatCSVTime(&session.ExpiresAt)})
+	}
+	err = writeCSVFile(archive, "sessions.csv", []string{"created_at", "updated_at", "expires_at"}, sessions)
+	if err != nil {
+		return err
+	}
+
+	emailTokens := [][]string{}
+	for _, token := range export.EmailTokens {
+		emailTokens = append(emailTokens, []string{
+			token.Email, token.Purpose, formatCSVTime(&token.CreatedAt), formatCSVTime(&token.ExpiresAt), formatCSVTime(token.UsedAt),
+		})
+	}
+	err = writeCSVFile(archive, "email_tokens.csv", []string{"email", "purpose", "created_at", "expires_at", "used_at"}, emailTokens)
+	if err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+func writeCSVFile(archive *zip.Writer, name string, header []string, rows [][]string) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(file)
+	if err = writer.Write(header); err != nil {
+		return err
+	}
+	return writer.WriteAll(rows)
+}
+
+func formatCSVTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func PostAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	// Schedule the deletion of the user's account after the grace period; the user is not notified in the meantime
+	w.Header().Set("Content-Type", "application/json")
+	currentUser := getCurrentUser(w, r)
+	if currentUser == nil {
+		http.Redirect(w, r, "/logout", 302)
+		return
+	}
+
+	db := context.Get(r, "db").(*sqlx.DB)
+
+	// A session alone is not enough, as whoever took it over could delete the account
+	response := AccountDeletionResponse{}
+	if _, err := models.NewUser(db).GetUserByEmailAndPassword(nil, currentUser.Email, r.FormValue("Password")); err != nil {
+		w.WriteHeader(403)
+	} else {
+		requestedAt := time.Now()
+		if err := models.NewUser(db).ScheduleDeletion(nil, currentUser.ID, requestedAt); err != nil {
+			handleError(w, r, err)
+			return
+		}
+		response.DeletionScheduledFor = deletionScheduledFor(&requestedAt)
+	}
+
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	w.Write(jsonResponse)
+}
+
+func DeleteAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	// Keep the account of a user who changed their mind during the grace period
+	w.Header().Set("Content-Type", "application/json")
+	currentUser := getCurrentUser(w, r)
+	if currentUser == nil {
+		http.Redirect(w, r, "/logout", 302)
+		return
+	}
+
+	db := context.Get(r, "db").(*sqlx.DB)
+
+	if err := models.NewUser(db).CancelDeletion(nil, currentUser.ID); err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(AccountDeletionResponse{})
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	w.Write(jsonResponse)
+}
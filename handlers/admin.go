@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/context"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/jpatrickpark/server1/models"
+	"github.com/jpatrickpark/server1/websoc"
+)
+
+const (
+	// adminUsersPerPage is the number of users listed on a page of /admin.
+	adminUsersPerPage = 50
+	// adminMostWatched is the number of most-watched courses shown on /admin.
+	adminMostWatched = 20
+	// adminOutboxSize is the number of latest notifications shown on /admin.
+	adminOutboxSize = 50
+)
+
+func GetAdmin(w http.ResponseWriter, r *http.Request) {
+	// Serve the status page for operators
+	w.Header().Set("Content-Type", "text/html")
+
+	db := context.Get(r, "db").(*sqlx.DB)
+	search := r.FormValue("q")
+	page, err := strconv.Atoi(r.FormValue("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	userStruct := models.NewUser(db)
+	users, err := userStruct.AdminUsers(nil, search, adminUsersPerPage, (page-1)*adminUsersPerPage)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	userCount, err := userStruct.CountUsers(nil, search)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	course := models.NewCourse(db)
+	quarters, err := course.WatchesByQuarter(nil)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	mostWatched, err := course.MostWatchedCourses(nil, PossibleQuarters(time.Now()), adminMostWatched)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	outbox, err := models.NewNotification(db).Outbox(nil, adminOutboxSize)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	// PrevPage and NextPage are 0 when there is no such page
+	prevPage, nextPage := page-1, page+1
+	if int64(page*adminUsersPerPage) >= userCount {
+		nextPage = 0
+	}
+
+	data := struct {
+		CurrentUser *models.UserRow
+		WebSoc      websoc.Status
+		Registrar   RegistrarHealth
+		StatusCache StatusCacheStats
+		Poller      PollerStats
+		Search      string
+		PrevPage    int
+		NextPage    int
+		UserCount   int64
+		Users       []models.AdminUserRow
+		Quarters    []models.QuarterWatches
+		MostWatched []models.WatchedCourse
+		Outbox      []models.OutboxRecord
+	}{
+		getCurrentUser(w, r), websoc.Default.Status(), CurrentRegistrarHealth(), CurrentStatusCacheStats(), CurrentPollerStats(),
+		search, prevPage, nextPage, userCount, users, quarters, mostWatched, outbox,
+	}
+
+	tmpl, err := template.ParseFiles("templates/dashboard.html.tmpl", "templates/admin.html.tmpl")
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	if err = tmpl.Execute(w, data); err != nil {
+		getLogger(r).Error("failed to render template", "template", "templates/admin.html.tmpl", "err", err)
+	}
+}
+
+// PostAdminRecheck returns the handler of POST /admin/courses/{id}/recheck, which checks the course on WebSoc with recheck
+// instead of waiting for the poller, and goes back to /admin.
+func PostAdminRecheck(recheck func(courseId int64) error) http.HandlerFunc {
+	return adminAction(recheck)
+}
+
+// PostAdminResend returns the handler of POST /admin/notifications/{id}/resend, which sends the notification again with resend
+// and goes back to /admin.
+func PostAdminResend(resend func(notificationId int64) error) http.HandlerFunc {
+	return adminAction(resend)
+}
+
+// ErrNotNotifiable is wrapped by the errors of actions that would mail a user who does not receive course alerts now.
+var ErrNotNotifiable = errors.New("the user does not receive course alerts")
+
+// adminAction runs the action on the {id} of the path, answering 404 when there is no such row
+// and 409 when the action would mail a user who does not receive course alerts.
+func adminAction(action func(id int64) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := getIdFromPath(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = action(id)
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if errors.Is(err, ErrNotNotifiable) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			handleError(w, r, err)
+			return
+		}
+
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+	}
+}
@@ -3,18 +3,39 @@ package handlers
 
 import (
 	"errors"
+	"github.com/jpatrickpark/server1/libhttp"
 	"github.com/jpatrickpark/server1/models"
 	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
-	"github.com/gorilla/sessions"
+	"log/slog"
 	"net/http"
 	"strconv"
 )
 
+// getCurrentUser returns the signed in user as loaded from the database for this request, or nil if there is none.
 func getCurrentUser(w http.ResponseWriter, r *http.Request) *models.UserRow {
-	sessionStore := context.Get(r, "sessionStore").(sessions.Store)
-	session, _ := sessionStore.Get(r, "server1-session")
-	return session.Values["user"].(*models.UserRow)
+	user, _ := context.Get(r, "currentUser").(*models.UserRow)
+	return user
+}
+
+// getLogger returns the logger of the request, which records its ID.
+func getLogger(r *http.Request) *slog.Logger {
+	if logger, ok := context.Get(r, "logger").(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// handleError logs the error with the context of the request and answers it as JSON.
+func handleError(w http.ResponseWriter, r *http.Request, err error) {
+	getLogger(r).Error("request failed", "err", err)
+	libhttp.HandleErrorJson(w, err)
+}
+
+// getCSRFToken returns the CSRF token of the session, which forms must send in the csrf_token field.
+func getCSRFToken(r *http.Request) string {
+	token, _ := context.Get(r, "csrfToken").(string)
+	return token
 }
 
 func getIdFromPath(w http.ResponseWriter, r *http.Request) (int64, error) {
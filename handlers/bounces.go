@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/context"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/jpatrickpark/server1/bounces"
+	"github.com/jpatrickpark/server1/models"
+)
+
+// EmailStatusResponse is the answer to GET /my-uci-class-is-full/email-status.
+type EmailStatusResponse struct {
+	Email         string `json:"email"`
+	Undeliverable bool   `json:"undeliverable"`
+	Reason        string `json:"reason"`
+}
+
+// PostSendGridEvents returns the handler of the SendGrid event webhook, which checks that requests are signed with publicKey.
+func PostSendGridEvents(publicKey string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Pause the alerts of addresses that bounced or complained
+		if publicKey == "" {
+			getLogger(r).Warn("bounces: rejected an event webhook request because sendgrid_webhook_public_key is not set")
+			http.Error(w, "event webhook is not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = bounces.VerifySendGridSignature(publicKey, r.Header.Get("X-Twilio-Email-Event-Webhook-Signature"), r.Header.Get("X-Twilio-Email-Event-Webhook-Timestamp"), body, time.Now())
+		if err != nil {
+			getLogger(r).Warn("bounces: rejected an event webhook request", "err", err)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		events, err := bounces.ParseSendGridEvents(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		db := context.Get(r, "db").(*sqlx.DB)
+		if err := bounces.Apply(db, events, getLogger(r)); err != nil {
+			// SendGrid retries requests answered with an error
+			handleError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func GetEmailStatus(w http.ResponseWriter, r *http.Request) {
+	// Tell whether mail to the user's address bounced, for the banner of the dashboard
+	w.Header().Set("Content-Type", "application/json")
+	currentUser := getCurrentUser(w, r)
+	if currentUser == nil {
+		http.Redirect(w, r, "/logout", 302)
+		return
+	}
+
+	db := context.Get(r, "db").(*sqlx.DB)
+
+	settings, err := models.NewUser(db).GetSettings(nil, currentUser.ID)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(EmailStatusResponse{currentUser.Email, settings.Undeliverable, settings.UndeliverableReason.String})
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	w.Write(jsonResponse)
+}
+
+func DeleteEmailStatus(w http.ResponseWriter, r *http.Request) {
+	// Resume the alerts of a user who says the address works again
+	w.Header().Set("Content-Type", "application/json")
+	currentUser := getCurrentUser(w, r)
+	if currentUser == nil {
+		http.Redirect(w, r, "/logout", 302)
+		return
+	}
+
+	db := context.Get(r, "db").(*sqlx.DB)
+
+	if err := models.NewUser(db).ClearUndeliverable(nil, currentUser.ID); err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(EmailStatusResponse{Email: currentUser.Email})
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	w.Write(jsonResponse)
+}
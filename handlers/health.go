@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	gorilla_context "github.com/gorilla/context"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/jpatrickpark/server1/models"
+	"github.com/jpatrickpark/server1/websoc"
+)
+
+// databasePingTimeout is how long GetReadyz waits for the database to answer.
+const databasePingTimeout = 2 * time.Second
+
+// HealthResponse is the answer to GET /healthz and GET /readyz.
+// Checks are only answered by /readyz, by name: database, poller and registrar.
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+// HealthCheck is the result of one check of GET /readyz.
+type HealthCheck struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func GetHealthz(w http.ResponseWriter, r *http.Request) {
+	// Tell a load balancer the process is up, without touching the database
+	writeHealthResponse(w, r, http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+func GetReadyz(w http.ResponseWriter, r *http.Request) {
+	// Tell a load balancer whether the app can serve users, with the result of every check
+	db := gorilla_context.Get(r, "db").(*sqlx.DB)
+	now := time.Now()
+
+	checks := map[string]HealthCheck{
+		"database":  checkDatabase(r.Context(), db),
+		"poller":    checkPoller(CurrentPollerStats(), now),
+		"registrar": checkRegistrar(websoc.Default.Status(), now),
+	}
+
+	response := HealthResponse{Status: "ok", Checks: checks}
+	code := http.StatusOK
+	for name, check := range checks {
+		if !check.OK {
+			getLogger(r).Warn("readyz: a check failed", "check", name, "detail", check.Detail)
+			response.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+		}
+	}
+	writeHealthResponse(w, r, code, response)
+}
+
+// checkDatabase pings the database, waiting at most databasePingTimeout.
+func checkDatabase(ctx context.Context, db *sqlx.DB) HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, databasePingTimeout)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		return HealthCheck{Detail: err.Error()}
+	}
+	return HealthCheck{OK: true}
+}
+
+// checkPoller fails when the poller has not started a cycle within models.StaleAfter,
+// the time after which the courses it should have checked are reported as stale.
+func checkPoller(stats PollerStats, now time.Time) HealthCheck {
+	if stats.LastHeartbeat.IsZero() {
+		return HealthCheck{Detail: "the poller has not started a cycle"}
+	}
+	age := now.Sub(stats.LastHeartbeat)
+	if age > models.StaleAfter {
+		return HealthCheck{Detail: fmt.Sprintf("the last cycle started %v ago", age.Round(time.Second))}
+	}
+	return HealthCheck{OK: true, Detail: fmt.Sprintf("the last cycle started %v ago", age.Round(time.Second))}
+}
+
+// checkRegistrar fails while the circuit breaker of the WebSoc client is open.
+// A half-open circuit is trying WebSoc again, so it passes.
+func checkRegistrar(status websoc.Status, now time.Time) HealthCheck {
+	if status.State == websoc.Open {
+		return HealthCheck{Detail: fmt.Sprintf("the WebSoc circuit is open for %v after: %v", status.OpenUntil.Sub(now).Round(time.Second), status.LastError)}
+	}
+	return HealthCheck{OK: true, Detail: "the WebSoc circuit is " + status.State}
+}
+
+func writeHealthResponse(w http.ResponseWriter, r *http.Request, code int, response HealthResponse) {
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	w.Write(jsonResponse)
+}
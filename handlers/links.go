@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"database/sql"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/jpatrickpark/server1/links"
+	"github.com/jpatrickpark/server1/models"
+	"github.com/jpatrickpark/server1/notify"
+)
+
+// linkPage is what templates/link.html.tmpl is executed with.
+type linkPage struct {
+	Locale  string
+	Message string
+	// Button is the label of the form that confirms the action, and empty when there is nothing to confirm.
+	Button string
+}
+
+func GetLink(w http.ResponseWriter, r *http.Request) {
+	// Ask the user to confirm the action of a link from a notification email
+	// The action is only taken on POST so that mail scanners following links do not take it
+	serveLink(w, r, false)
+}
+
+func PostLink(w http.ResponseWriter, r *http.Request) {
+	// Take the action of a link from a notification email
+	serveLink(w, r, true)
+}
+
+// serveLink verifies the token of the request, whoever is signed in, and takes its action if confirmed.
+func serveLink(w http.ResponseWriter, r *http.Request, confirmed bool) {
+	db := context.Get(r, "db").(*sqlx.DB)
+	now := time.Now()
+
+	claims, err := links.Default.Verify(mux.Vars(r)["token"], now)
+	if err == links.ErrInvalidToken {
+		writeLinkPage(w, r, http.StatusBadRequest, notify.DefaultLocale, "landing.invalid")
+		return
+	}
+	locale, lookupErr := UserLocale(db, claims.UserID)
+	if lookupErr != nil {
+		if lookupErr != sql.ErrNoRows {
+			getLogger(r).Warn("links: failed to look up locale", "user_id", claims.UserID, "err", lookupErr)
+		}
+		locale = notify.DefaultLocale
+	}
+	if err == links.ErrExpiredToken {
+		writeLinkPage(w, r, http.StatusGone, locale, "landing.expired")
+		return
+	}
+	if claims.Action == links.Unsubscribe {
+		serveUnsubscribe(w, r, db, claims, locale, confirmed)
+		return
+	}
+	if claims.Action != links.StopWatching && claims.Action != links.Snooze {
+		writeLinkPage(w, r, http.StatusBadRequest, locale, "landing.invalid")
+		return
+	}
+
+	course, err := models.NewCourse(db).GetCourseById(nil, claims.CourseID)
+	if err == nil {
+		_, err = models.NewUserCoursePair(db).GetPairByCourseIdAndUserId(nil, claims.CourseID, claims.UserID)
+	}
+	if err == sql.ErrNoRows {
+		writeLinkPage(w, r, http.StatusNotFound, locale, "landing.not_watched")
+		return
+	}
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	t, err := notify.NewTranslator(locale)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	quarter := t.Quarter(course.Quarter)
+
+	if !confirmed {
+		page := linkPage{Locale: t.Locale}
+		page.Message = t.T("landing."+claims.Action+".title", course.CourseCode, quarter)
+		page.Button = t.T("landing." + claims.Action + ".button")
+		renderLinkPage(w, r, http.StatusOK, page)
+		return
+	}
+
+	page := linkPage{Locale: t.Locale}
+	switch claims.Action {
+	case links.StopWatching:
+		_, err = models.NewUserCoursePair(db).RemoveUserCoursePair(nil, claims.UserID, course.CourseCode, course.Quarter)
+		page.Message = t.T("landing.stop.done", course.CourseCode, quarter)
+	case links.Snooze:
+		until := now.Add(links.SnoozeFor)
+		_, err = models.NewUserCoursePair(db).SnoozePair(nil, claims.UserID, claims.CourseID, until)
+		page.Message = t.T("landing.snooze.done", course.CourseCode, quarter, until.Format("Jan 2 15:04 MST"))
+	}
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	renderLinkPage(w, r, http.StatusOK, page)
+}
+
+// serveUnsubscribe unsubscribes the user of the claims from all course alerts if confirmed.
+// Mail clients confirm it by POSTing to the List-Unsubscribe URL.
+func serveUnsubscribe(w http.ResponseWriter, r *http.Request, db *sqlx.DB, claims links.Claims, locale string, confirmed bool) {
+	t, err := notify.NewTranslator(locale)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	if !confirmed {
+		renderLinkPage(w, r, http.StatusOK, linkPage{Locale: t.Locale, Message: t.T("landing.unsubscribe.title"), Button: t.T("landing.unsubscribe.button")})
+		return
+	}
+
+	err = models.NewUser(db).UpdateSubscription(nil, claims.UserID, false)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	renderLinkPage(w, r, http.StatusOK, linkPage{Locale: t.Locale, Message: t.T("landing.unsubscribe.done")})
+}
+
+// writeLinkPage answers with a page that only shows the message of the key.
+func writeLinkPage(w http.ResponseWriter, r *http.Request, httpStatus int, locale, key string) {
+	t, err := notify.NewTranslator(locale)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	renderLinkPage(w, r, httpStatus, linkPage{Locale: t.Locale, Message: t.T(key)})
+}
+
+func renderLinkPage(w http.ResponseWriter, r *http.Request, httpStatus int, page linkPage) {
+	tmpl, err := template.ParseFiles("templates/link.html.tmpl")
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(httpStatus)
+	if err = tmpl.Execute(w, page); err != nil {
+		getLogger(r).Error("failed to render template", "template", "templates/link.html.tmpl", "err", err)
+	}
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/context"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/jpatrickpark/server1/models"
+	"github.com/jpatrickpark/server1/notify"
+	"github.com/jpatrickpark/server1/rules"
+)
+
+// LocaleResponse is the answer to PUT /my-uci-class-is-full/locale.
+type LocaleResponse struct {
+	Locale  string   `json:"locale"`
+	Locales []string `json:"locales"`
+}
+
+// UserLocale returns the locale the user receives notifications in.
+func UserLocale(db *sqlx.DB, userId int64) (string, error) {
+	settings, err := models.NewUser(db).GetSettings(nil, userId)
+	if err != nil {
+		return "", err
+	}
+	return notify.UserLocale(settings), nil
+}
+
+// SubscriptionResponse is the answer to PUT /my-uci-class-is-full/subscription.
+type SubscriptionResponse struct {
+	Subscribed bool `json:"subscribed"`
+}
+
+func PutLocale(w http.ResponseWriter, r *http.Request) {
+	// Set the locale the user receives notifications in
+	w.Header().Set("Content-Type", "application/json")
+	currentUser := getCurrentUser(w, r)
+	if currentUser == nil {
+		http.Redirect(w, r, "/logout", 302)
+		return
+	}
+
+	db := context.Get(r, "db").(*sqlx.DB)
+
+	response := LocaleResponse{Locale: r.FormValue("locale"), Locales: notify.Locales}
+	if !notify.IsLocale(response.Locale) {
+		w.WriteHeader(422)
+	} else if err := models.NewUser(db).UpdateLocale(nil, currentUser.ID, response.Locale); err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	w.Write(jsonResponse)
+}
+
+func PutSubscription(w http.ResponseWriter, r *http.Request) {
+	// Unsubscribe the user from all course alerts, or subscribe the user again
+	w.Header().Set("Content-Type", "application/json")
+	currentUser := getCurrentUser(w, r)
+	if currentUser == nil {
+		http.Redirect(w, r, "/logout", 302)
+		return
+	}
+
+	db := context.Get(r, "db").(*sqlx.DB)
+
+	response := SubscriptionResponse{Subscribed: r.FormValue("subscribed") == "true"}
+	if err := models.NewUser(db).UpdateSubscription(nil, currentUser.ID, response.Subscribed); err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	w.Write(jsonResponse)
+}
+
+// DigestResponse is the answer to PUT /my-uci-class-is-full/digest.
+type DigestResponse struct {
+	Digest bool `json:"digest"`
+}
+
+func PutDigest(w http.ResponseWriter, r *http.Request) {
+	// Choose between a daily digest and an alert for every change
+	w.Header().Set("Content-Type", "application/json")
+	currentUser := getCurrentUser(w, r)
+	if currentUser == nil {
+		http.Redirect(w, r, "/logout", 302)
+		return
+	}
+
+	db := context.Get(r, "db").(*sqlx.DB)
+
+	response := DigestResponse{Digest: r.FormValue("digest") == "true"}
+	if err := models.NewUser(db).UpdateDigest(nil, currentUser.ID, response.Digest); err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	w.Write(jsonResponse)
+}
+
+func GetNotificationPreview(w http.ResponseWriter, r *http.Request) {
+	// Render a course alert with made up values so that its templates and translations can be reviewed
+	// Query values: locale, kind (status, seats, waitlist or closed), status (a status code), seats, courseCode, quarter and format (html or text)
+	alert := notify.Alert{
+		CourseCode: r.FormValue("courseCode"),
+		Quarter:    r.FormValue("quarter"),
+		Event:      rules.Event{Kind: r.FormValue("kind"), Status: models.OPEN, SeatsAvailable: 3},
+	}
+	if alert.CourseCode == "" {
+		alert.CourseCode = "20025"
+	}
+	if alert.Quarter == "" {
+		alert.Quarter = CurrentQuarter(time.Now())
+	}
+	if alert.Event.Kind == "" {
+		alert.Event.Kind = rules.StatusChanged
+	}
+	if code := r.FormValue("status"); code != "" {
+		status, ok := models.StatusFromCode(code)
+		if !ok {
+			http.Error(w, "unknown status "+code, 422)
+			return
+		}
+		alert.Event.Status = status
+	}
+	if seats := r.FormValue("seats"); seats != "" {
+		var err error
+		if alert.Event.SeatsAvailable, err = strconv.Atoi(seats); err != nil {
+			http.Error(w, "invalid seats "+seats, 422)
+			return
+		}
+	}
+
+	message, err := notify.RenderAlert(r.FormValue("locale"), alert)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	if r.FormValue("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("Subject: " + message.Subject + "\n\n" + message.Text))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(message.HTML))
+}
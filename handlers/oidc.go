@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	gorilla_context "github.com/gorilla/context"
+	"github.com/gorilla/sessions"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/oauth2"
+
+	"github.com/jpatrickpark/server1/models"
+)
+
+// OIDCLogin signs users in with an OpenID Connect provider such as the UCI NetID single sign-on.
+// Users are matched to accounts by their verified email, and an account is created for new addresses.
+type OIDCLogin struct {
+	config   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDCLogin discovers the provider at issuer. redirectURL is the URL of GetCallback registered with the provider,
+// such as https://apps.jpatrickpark.com/login/oidc/callback.
+func NewOIDCLogin(ctx context.Context, issuer, clientID, clientSecret, redirectURL string) (*OIDCLogin, error) {
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OIDCLogin{
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "email"},
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
+	}, nil
+}
+
+// randomString returns a random URL safe string for states, nonces and passwords.
+func randomString() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
+
+func (o *OIDCLogin) GetLogin(w http.ResponseWriter, r *http.Request) {
+	// Send the user to the provider, remembering what the callback has to check in the session
+	sessionStore := gorilla_context.Get(r, "sessionStore").(sessions.Store)
+	session, _ := sessionStore.Get(r, "server1-session")
+
+	state, err := randomString()
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	nonce, err := randomString()
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	session.Values["oidcState"] = state
+	session.Values["oidcNonce"] = nonce
+	session.Values["oidcVerifier"] = verifier
+	if err := session.Save(r, w); err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, o.config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), 302)
+}
+
+func (o *OIDCLogin) GetCallback(w http.ResponseWriter, r *http.Request) {
+	// Sign in the user the provider vouches for
+	sessionStore := gorilla_context.Get(r, "sessionStore").(sessions.Store)
+	session, _ := sessionStore.Get(r, "server1-session")
+
+	state, _ := session.Values["oidcState"].(string)
+	nonce, _ := session.Values["oidcNonce"].(string)
+	verifier, _ := session.Values["oidcVerifier"].(string)
+	delete(session.Values, "oidcState")
+	delete(session.Values, "oidcNonce")
+	delete(session.Values, "oidcVerifier")
+
+	if state == "" || r.FormValue("state") != state {
+		http.Error(w, "The sign in request expired. Please sign in again.", http.StatusBadRequest)
+		return
+	}
+	if errorCode := r.FormValue("error"); errorCode != "" {
+		http.Error(w, "The sign in was not completed: "+errorCode, http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+	token, err := o.config.Exchange(ctx, r.FormValue("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		getLogger(r).Error("oidc: failed to exchange the code", "err", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		getLogger(r).Error("oidc: the provider did not return an ID token")
+		http.Error(w, "The provider did not return an ID token.", http.StatusBadGateway)
+		return
+	}
+	idToken, err := o.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		getLogger(r).Warn("oidc: rejected an ID token", "err", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if idToken.Nonce != nonce {
+		http.Error(w, "The ID token does not belong to this sign in.", http.StatusForbidden)
+		return
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		handleError(w, r, err)
+		return
+	}
+	if claims.Email == "" || !claims.EmailVerified {
+		http.Error(w, "The provider did not verify your email address.", http.StatusForbidden)
+		return
+	}
+
+	db := gorilla_context.Get(r, "db").(*sqlx.DB)
+	user, err := oidcUser(db, claims.Email)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	// The session store gives the session a new ID, but the CSRF token of the signed out session has to go here
+	delete(session.Values, "csrfToken")
+	session.Values["user"] = &models.UserRow{ID: user.ID}
+	if err := session.Save(r, w); err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/", 302)
+}
+
+// oidcUser returns the account of the verified email, creating it if there is none.
+// New accounts get a random password, which their users can replace with the password reset flow.
+func oidcUser(db *sqlx.DB, email string) (*models.UserRow, error) {
+	userStruct := models.NewUser(db)
+
+	user, err := userStruct.GetByEmail(nil, email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err != nil {
+		password, err := randomString()
+		if err != nil {
+			return nil, err
+		}
+		if user, err = userStruct.Signup(nil, email, password, password); err != nil {
+			return nil, err
+		}
+	} else {
+		settings, err := userStruct.GetSettings(nil, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		// Whoever signed up with the address before its owner must not keep a password or a session of the account
+		if !settings.Verified {
+			password, err := randomString()
+			if err != nil {
+				return nil, err
+			}
+			if user, err = userStruct.UpdateEmailAndPasswordById(nil, user.ID, user.Email, password, password); err != nil {
+				return nil, err
+			}
+			if _, err := models.NewSession(db).DeleteSessionsByUserId(nil, user.ID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// The provider verified the address, so the user does not need a verification email
+	if _, err := userStruct.VerifyEmail(nil, user.ID, email); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
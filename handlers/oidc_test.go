@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	gorilla_context "github.com/gorilla/context"
+	"github.com/gorilla/sessions"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/jpatrickpark/server1/testdb"
+)
+
+const testClientID = "myuciclassisfull"
+
+// testProvider is an OpenID Connect provider whose token endpoint returns an ID token with claims.
+type testProvider struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]interface{}
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     p.idToken(t),
+		})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// idToken signs the claims of the provider with RS256.
+func (p *testProvider) idToken(t *testing.T) string {
+	claims := map[string]interface{}{
+		"iss": p.URL,
+		"aud": testClientID,
+		"sub": "12345678",
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for name, value := range p.claims {
+		claims[name] = value
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Error(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Error(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// oidcRequest returns a request with the session store and database set as the middlewares do.
+func oidcRequest(target string, store sessions.Store, db *sqlx.DB, cookies []*http.Cookie) *http.Request {
+	r := httptest.NewRequest("GET", target, nil)
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	gorilla_context.Set(r, "sessionStore", store)
+	if db != nil {
+		gorilla_context.Set(r, "db", db)
+	}
+	return r
+}
+
+// startSignIn runs GetLogin and returns the session cookies with the state and nonce sent to the provider.
+func startSignIn(t *testing.T, login *OIDCLogin, store sessions.Store) ([]*http.Cookie, string, string) {
+	w := httptest.NewRecorder()
+	login.GetLogin(w, oidcRequest("/login/oidc", store, nil, nil))
+	if w.Code != 302 {
+		t.Fatalf("GetLogin answered %v; want 302", w.Code)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := location.Query()
+	return w.Result().Cookies(), query.Get("state"), query.Get("nonce")
+}
+
+// signIn runs the sign in with the provider, which returns the claims, and returns the answer of GetCallback.
+func signIn(t *testing.T, p *testProvider, db *sqlx.DB, claims map[string]interface{}) *httptest.ResponseRecorder {
+	login, err := NewOIDCLogin(context.Background(), p.URL, testClientID, "secret", "http://localhost/login/oidc/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))
+
+	cookies, state, nonce := startSignIn(t, login, store)
+	p.claims = map[string]interface{}{"nonce": nonce}
+	for name, value := range claims {
+		p.claims[name] = value
+	}
+
+	w := httptest.NewRecorder()
+	login.GetCallback(w, oidcRequest("/login/oidc/callback?code=code&state="+url.QueryEscape(state), store, db, cookies))
+	return w
+}
+
+func TestOIDCCallbackRefusals(t *testing.T) {
+	p := newTestProvider(t)
+
+	// A callback that does not carry the state of the session, as in login CSRF
+	login, err := NewOIDCLogin(context.Background(), p.URL, testClientID, "secret", "http://localhost/login/oidc/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))
+	cookies, _, _ := startSignIn(t, login, store)
+	w := httptest.NewRecorder()
+	login.GetCallback(w, oidcRequest("/login/oidc/callback?code=code&state=forged", store, nil, cookies))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("callback with another state answered %v; want 400", w.Code)
+	}
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+	}{
+		{"an ID token of another sign in", map[string]interface{}{"nonce": "replayed", "email": "student@uci.edu", "email_verified": true}},
+		{"an unverified address", map[string]interface{}{"email": "student@uci.edu", "email_verified": false}},
+		{"no address", map[string]interface{}{"email_verified": true}},
+	}
+	for _, test := range tests {
+		if w := signIn(t, p, nil, test.claims); w.Code != http.StatusForbidden {
+			t.Errorf("callback with %v answered %v; want 403", test.name, w.Code)
+		}
+	}
+}
+
+func TestOIDCCallbackSignsIn(t *testing.T) {
+	db := testdb.New(t, testdb.Users, testdb.Sessions)
+	p := newTestProvider(t)
+
+	var existingId int64
+	if err := db.Get(&existingId, "INSERT INTO users (email, password) VALUES ('student@uci.edu', 'x') RETURNING id"); err != nil {
+		t.Fatal(err)
+	}
+	db.MustExec("INSERT INTO users (email, password, verified_email) VALUES ('verified@uci.edu', 'y', 'verified@uci.edu')")
+	db.MustExec("INSERT INTO sessions (id, user_id, expires_at) VALUES ('planted', $1, NOW() + INTERVAL '1 day')", existingId)
+
+	for _, email := range []string{"student@uci.edu", "newstudent@uci.edu", "verified@uci.edu"} {
+		w := signIn(t, p, db, map[string]interface{}{"email": email, "email_verified": true})
+		if w.Code != 302 || w.Header().Get("Location") != "/" {
+			t.Fatalf("callback for %v answered %v to %v; want 302 to /", email, w.Code, w.Header().Get("Location"))
+		}
+
+		// The account of the address is signed in, and the provider verified its address
+		var ids []int64
+		if err := db.Select(&ids, "SELECT id FROM users WHERE email=$1 AND verified_email=$1", email); err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) != 1 {
+			t.Fatalf("%v verified accounts of %v; want 1", len(ids), email)
+		}
+		if email == "student@uci.edu" && ids[0] != existingId {
+			t.Fatalf("callback created account %v; want the existing account %v", ids[0], existingId)
+		}
+	}
+
+	// Someone who signed up with the address before verifying it loses the password and sessions, unlike a verified owner
+	var passwords []string
+	if err := db.Select(&passwords, "SELECT password FROM users WHERE email IN ('student@uci.edu', 'verified@uci.edu') ORDER BY email"); err != nil {
+		t.Fatal(err)
+	}
+	if passwords[0] == "x" {
+		t.Error("the unverified account kept its password")
+	}
+	if passwords[1] != "y" {
+		t.Error("the verified account lost its password")
+	}
+	var planted int
+	if err := db.Get(&planted, "SELECT COUNT(*) FROM sessions WHERE id='planted'"); err != nil {
+		t.Fatal(err)
+	}
+	if planted != 0 {
+		t.Error("the unverified account kept its session")
+	}
+}
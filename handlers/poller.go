@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+// PollerStats describes the last completed cycle of the poller.
+// LastHeartbeat is when the last cycle started, whether or not it completed.
+type PollerStats struct {
+	LastHeartbeat time.Time
+	Cycles        int64
+	LastStarted   time.Time
+	LastDuration  time.Duration
+	Courses       int
+	Failures      int
+	Stale         int64
+}
+
+var poller struct {
+	sync.Mutex
+	stats PollerStats
+}
+
+func init() {
+	expvar.Publish("poller", expvar.Func(func() interface{} {
+		return CurrentPollerStats()
+	}))
+}
+
+// RecordPollerHeartbeat records that a cycle of the poller started at the time.
+func RecordPollerHeartbeat(at time.Time) {
+	poller.Lock()
+	defer poller.Unlock()
+
+	poller.stats.LastHeartbeat = at
+}
+
+// RecordPollerCycle records a cycle of the poller that started at started and checked courses courses,
+// failures of which could not be checked or recorded, and found stale courses stale.
+func RecordPollerCycle(started time.Time, courses, failures int, stale int64) {
+	poller.Lock()
+	defer poller.Unlock()
+
+	poller.stats.Cycles++
+	poller.stats.LastStarted = started
+	poller.stats.LastDuration = time.Since(started)
+	poller.stats.Courses = courses
+	poller.stats.Failures = failures
+	poller.stats.Stale = stale
+}
+
+// CurrentPollerStats returns the stats of the last cycle of the poller.
+func CurrentPollerStats() PollerStats {
+	poller.Lock()
+	defer poller.Unlock()
+
+	return poller.stats
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+// recentRegistrarErrors is the number of errors RegistrarHealth keeps.
+const recentRegistrarErrors = 10
+
+// RegistrarError is a failed course status lookup.
+type RegistrarError struct {
+	At    time.Time
+	Error string
+}
+
+// RegistrarHealth describes how WebSoc answered the recent course status lookups.
+// RecentErrors are the last failed lookups, newest first.
+type RegistrarHealth struct {
+	LastSuccess         time.Time
+	LastFailure         time.Time
+	LastError           string
+	ConsecutiveFailures int
+	RecentErrors        []RegistrarError
+}
+
+// Healthy reports whether the last lookup succeeded.
+func (h RegistrarHealth) Healthy() bool {
+	return h.ConsecutiveFailures == 0
+}
+
+var registrar struct {
+	sync.Mutex
+	health RegistrarHealth
+}
+
+func init() {
+	expvar.Publish("registrar", expvar.Func(func() interface{} {
+		return CurrentRegistrarHealth()
+	}))
+}
+
+func recordRegistrarResult(err error) {
+	registrar.Lock()
+	defer registrar.Unlock()
+
+	if err != nil {
+		registrar.health.LastFailure = time.Now()
+		registrar.health.LastError = err.Error()
+		registrar.health.ConsecutiveFailures++
+		recent := append([]RegistrarError{{registrar.health.LastFailure, registrar.health.LastError}}, registrar.health.RecentErrors...)
+		if len(recent) > recentRegistrarErrors {
+			recent = recent[:recentRegistrarErrors]
+		}
+		registrar.health.RecentErrors = recent
+		return
+	}
+	registrar.health.LastSuccess = time.Now()
+	registrar.health.ConsecutiveFailures = 0
+}
+
+// CurrentRegistrarHealth returns the health of WebSoc as seen by CourseSnapshot.
+func CurrentRegistrarHealth() RegistrarHealth {
+	registrar.Lock()
+	defer registrar.Unlock()
+
+	return registrar.health
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"expvar"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/jpatrickpark/server1/models"
+)
+
+const (
+	// statusCacheTTL is how long a course snapshot fetched from WebSoc is reused.
+	statusCacheTTL = 30 * time.Second
+	// statusCacheSweepSize is the number of entries above which expired entries are swept on store.
+	statusCacheSweepSize = 1024
+)
+
+type cachedSnapshot struct {
+	snapshot  models.Snapshot
+	fetchedAt time.Time
+}
+
+var statusCache = struct {
+	sync.Mutex
+	entries map[string]cachedSnapshot
+}{entries: make(map[string]cachedSnapshot)}
+
+var statusGroup singleflight.Group
+
+var (
+	statusCacheStats     = expvar.NewMap("status_cache")
+	statusCacheHits      = new(expvar.Int)
+	statusCacheMisses    = new(expvar.Int)
+	statusCacheCoalesced = new(expvar.Int)
+)
+
+func init() {
+	statusCacheStats.Set("hits", statusCacheHits)
+	statusCacheStats.Set("misses", statusCacheMisses)
+	statusCacheStats.Set("coalesced", statusCacheCoalesced)
+}
+
+// StatusCacheStats counts how course status lookups were answered.
+// Coalesced lookups waited for a concurrent WebSoc request for the same course instead of sending their own.
+type StatusCacheStats struct {
+	Hits      int64
+	Misses    int64
+	Coalesced int64
+}
+
+// CurrentStatusCacheStats returns the counters of the course status cache.
+func CurrentStatusCacheStats() StatusCacheStats {
+	return StatusCacheStats{statusCacheHits.Value(), statusCacheMisses.Value(), statusCacheCoalesced.Value()}
+}
+
+// CachedCourseSnapshot is CourseSnapshot behind a short-lived cache shared by PutTerm and the poller.
+// Concurrent lookups of the same course share a single WebSoc request. Failed lookups are not cached.
+func CachedCourseSnapshot(currentQuarter, courseCode string) (models.Snapshot, error) {
+	key := currentQuarter + "/" + courseCode
+
+	if snapshot, ok := lookupCachedSnapshot(key); ok {
+		statusCacheHits.Add(1)
+		return snapshot, nil
+	}
+	statusCacheMisses.Add(1)
+
+	// shared is also true for the lookup that sent the request, so only the others are counted as coalesced
+	sent := false
+	snapshot, err, _ := statusGroup.Do(key, func() (interface{}, error) {
+		sent = true
+		snapshot, err := CourseSnapshot(currentQuarter, courseCode)
+		if err == nil {
+			storeCachedSnapshot(key, snapshot)
+		}
+		return snapshot, err
+	})
+	if !sent {
+		statusCacheCoalesced.Add(1)
+	}
+	return snapshot.(models.Snapshot), err
+}
+
+// RefreshCourseSnapshot is CourseSnapshot that also replaces the cached snapshot of the course,
+// for operators who want the current status of a course without waiting for the cache to expire.
+func RefreshCourseSnapshot(currentQuarter, courseCode string) (models.Snapshot, error) {
+	snapshot, err := CourseSnapshot(currentQuarter, courseCode)
+	if err == nil {
+		storeCachedSnapshot(currentQuarter+"/"+courseCode, snapshot)
+	}
+	return snapshot, err
+}
+
+func lookupCachedSnapshot(key string) (models.Snapshot, bool) {
+	statusCache.Lock()
+	defer statusCache.Unlock()
+
+	entry, ok := statusCache.entries[key]
+	if !ok {
+		return models.Snapshot{}, false
+	}
+	if time.Since(entry.fetchedAt) > statusCacheTTL {
+		delete(statusCache.entries, key)
+		return models.Snapshot{}, false
+	}
+	return entry.snapshot, true
+}
+
+func storeCachedSnapshot(key string, snapshot models.Snapshot) {
+	statusCache.Lock()
+	defer statusCache.Unlock()
+
+	now := time.Now()
+	if len(statusCache.entries) >= statusCacheSweepSize {
+		for k, entry := range statusCache.entries {
+			if now.Sub(entry.fetchedAt) > statusCacheTTL {
+				delete(statusCache.entries, k)
+			}
+		}
+	}
+	statusCache.entries[key] = cachedSnapshot{snapshot, now}
+}
@@ -6,28 +6,30 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
 	"github.com/jmoiron/sqlx"
-	"github.com/jpatrickpark/server1/libhttp"
 	"github.com/jpatrickpark/server1/models"
+	"github.com/jpatrickpark/server1/notify"
+	"github.com/jpatrickpark/server1/rules"
+	"github.com/jpatrickpark/server1/websoc"
 	"html/template"
-	"io/ioutil"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 )
 
 const (
-	spring        = "-14"
-	summer1       = "-25"
-	summer10      = "-39"
-	summerCom     = "-51"
-	summer2       = "-76"
-	fall          = "-92"
-	winter        = "-03"
-	urlFirstHalf  = "https://www.reg.uci.edu/perl/WebSoc?YearTerm="
-	urlSecondHalf = "&ShowFinals=0&ShowComments=0&CourseCodes="
+	spring    = "-14"
+	summer1   = "-25"
+	summer10  = "-39"
+	summerCom = "-51"
+	summer2   = "-76"
+	fall      = "-92"
+	winter    = "-03"
 )
 
+var courseCodePattern = regexp.MustCompile("^[0-9]{5}$")
+
 func PossibleQuarters(now time.Time) []string {
 	// Generate a list of all the quarters that might be open for the students at the moment
 	year := now.String()[0:4]
@@ -65,6 +67,17 @@ func PossibleQuarters(now time.Time) []string {
 	}
 	return possibleQuarters
 }
+func OldestPossibleQuarter(now time.Time) string {
+	// Quarters sort chronologically as strings, so every quarter before this one is closed for the students
+	possibleQuarters := PossibleQuarters(now)
+	oldest := ""
+	for _, quarter := range possibleQuarters {
+		if oldest == "" || quarter < oldest {
+			oldest = quarter
+		}
+	}
+	return oldest
+}
 func CurrentQuarter(now time.Time) string {
 	// Indicate either students are eligible for spring, fall, or winter quarter
 	switch now.Month() {
@@ -140,36 +153,75 @@ func GetTerm(w http.ResponseWriter, r *http.Request) {
 	session.Values["currentQuarter"] = currentQuarter
 	err := session.Save(r, w)
 	if err != nil {
-		libhttp.HandleErrorJson(w, err)
+		handleError(w, r, err)
 		return
 	}
 	http.Redirect(w, r, "/my-uci-class-is-full", 302)
 }
 
+// PutDeleteTermResponse is the JSON body of PUT and DELETE term responses.
+// Status is one of the generated status constants, Code is its string form and Message describes it.
+// The HTTP status code of the response is models.StatusHTTPStatus(Status).
 type PutDeleteTermResponse struct {
 	Status  int                `json:"status"`
+	Code    string             `json:"code"`
+	Message string             `json:"message"`
 	Courses []models.CourseRow `json:"courses"`
 }
 
-func CourseStatus(currentQuarter, courseCode string) int {
-	// Get current status of a course from web
-	resp, err := http.Get(urlFirstHalf + currentQuarter + urlSecondHalf + courseCode)
+// TermCoursesResponse is the JSON body of the list of courses a user watches in a term.
+type TermCoursesResponse struct {
+	Courses []models.CourseRow `json:"courses"`
+}
+
+func writeTermResponse(w http.ResponseWriter, r *http.Request, structResponse PutDeleteTermResponse) {
+	structResponse.Code = models.StatusCode(structResponse.Status)
+	structResponse.Message = models.StatusMessage(structResponse.Status)
+
+	jsonResponse, err := json.Marshal(structResponse)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	w.WriteHeader(models.StatusHTTPStatus(structResponse.Status))
+	w.Write(jsonResponse)
+}
+
+func CourseSnapshot(currentQuarter, courseCode string) (models.Snapshot, error) {
+	// Get current status and seat counts of a course from web
+	// UNKNOWN is returned with the error when WebSoc could not be reached or answered with an error
+	byteResp, err := websoc.Default.Get(websoc.SectionURL(currentQuarter, courseCode))
+	recordRegistrarResult(err)
 	if err != nil {
-		return models.NONEXISTENT
+		return models.Snapshot{Status: models.UNKNOWN}, err
+	}
+	section, err := websoc.ParseSection(byteResp, courseCode)
+	if err == websoc.ErrSectionNotFound {
+		return models.Snapshot{Status: models.NONEXISTENT, MaxSeats: -1, Enrolled: -1, Waitlisted: -1}, nil
 	}
-	byteResp, _ := ioutil.ReadAll(resp.Body)
-	defer resp.Body.Close()
-	stringResp := string(byteResp)
-	if strings.Contains(stringResp, "FULL") {
+	if err != nil {
+		return models.Snapshot{Status: models.UNKNOWN}, err
+	}
+	return models.Snapshot{
+		Status:     sectionStatus(section.Status),
+		MaxSeats:   section.Max,
+		Enrolled:   section.Enrolled,
+		Waitlisted: section.Waitlist,
+		Section:    section,
+	}, nil
+}
+func sectionStatus(status string) int {
+	// Convert the Status column of WebSoc into one of the status constants
+	if strings.Contains(status, "FULL") {
 		return models.FULL
 	}
-	if strings.Contains(stringResp, "OPEN") {
+	if strings.Contains(status, "OPEN") {
 		return models.OPEN
 	}
-	if strings.Contains(stringResp, "Waitl") {
+	if strings.Contains(status, "Waitl") {
 		return models.WAITLIST
 	}
-	if strings.Contains(stringResp, "NewOnly") {
+	if strings.Contains(status, "NewOnly") {
 		return models.NEWONLY_FULL
 		// CURRENTLY THERE IS NO WAY TO DETERMINE IF THE WAITLIST IS FULL
 		/*
@@ -190,11 +242,9 @@ func DeleteTerm(w http.ResponseWriter, r *http.Request) {
 	courseCode := mux.Vars(r)["courseCode"]
 
 	//Get user information and DB from Session and Context
-	sessionStore := context.Get(r, "sessionStore").(sessions.Store)
 	_, _ = quarter, courseCode
-	session, _ := sessionStore.Get(r, "server1-session")
-	currentUser, ok := session.Values["user"].(*models.UserRow)
-	if !ok {
+	currentUser := getCurrentUser(w, r)
+	if currentUser == nil {
 		http.Redirect(w, r, "/logout", 302)
 		return
 	}
@@ -204,33 +254,30 @@ func DeleteTerm(w http.ResponseWriter, r *http.Request) {
 	structResponse := PutDeleteTermResponse{}
 
 	//Try deleting the given user-course pair
-	structResponse.Status = models.NewUserCoursePair(db).RemoveUserCoursePair(nil, currentUser.ID, courseCode, quarter)
+	status, err := models.NewUserCoursePair(db).RemoveUserCoursePair(nil, currentUser.ID, courseCode, quarter)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	structResponse.Status = status
 
 	//Return the list of user-course pair after the deletion
 	courses, err := models.NewCourse(db).GetCoursesByUserIdAndQuarter(nil, currentUser.ID, quarter)
 	if err != nil {
-		libhttp.HandleErrorJson(w, err)
+		handleError(w, r, err)
 		return
 	}
 	structResponse.Courses = *courses
 
-	jsonResponse, err := json.Marshal(structResponse)
-	if err != nil {
-		libhttp.HandleErrorJson(w, err)
-		return
-	}
-	w.Write(jsonResponse)
+	writeTermResponse(w, r, structResponse)
 }
 func PutTerm(w http.ResponseWriter, r *http.Request) {
 	// Record user's request for a given course for a given term
 	w.Header().Set("Content-Type", "application/json")
 	courseCode := r.FormValue("courseCode")
 	currentQuarter := mux.Vars(r)["quarter"]
-	sessionStore := context.Get(r, "sessionStore").(sessions.Store)
-
-	session, _ := sessionStore.Get(r, "server1-session")
-	currentUser, ok := session.Values["user"].(*models.UserRow)
-	if !ok {
+	currentUser := getCurrentUser(w, r)
+	if currentUser == nil {
 		http.Redirect(w, r, "/logout", 302)
 		return
 	}
@@ -239,17 +286,28 @@ func PutTerm(w http.ResponseWriter, r *http.Request) {
 
 	// Construct JSON object for response
 	structResponse := PutDeleteTermResponse{}
-	structResponse.Status = CourseStatus(currentQuarter, courseCode)
+	var snapshot models.Snapshot
+	if !courseCodePattern.MatchString(courseCode) || !Contains(PossibleQuarters(time.Now()), currentQuarter) {
+		structResponse.Status = models.INVALID
+	} else {
+		// A failed lookup leaves UNKNOWN as the status, which is answered with 502
+		var err error
+		snapshot, err = CachedCourseSnapshot(currentQuarter, courseCode)
+		if err != nil {
+			getLogger(r).Warn("failed to look up course", "course_code", courseCode, "quarter", currentQuarter, "err", err)
+		}
+		structResponse.Status = snapshot.Status
+	}
 	var exists bool
-	if structResponse.Status != models.NONEXISTENT {
-		requestedCourse, err := models.NewCourse(db).AddCourse(nil, structResponse.Status, courseCode, currentQuarter)
+	if structResponse.Status != models.NONEXISTENT && structResponse.Status != models.INVALID && structResponse.Status != models.UNKNOWN {
+		requestedCourse, err := models.NewCourse(db).AddCourse(nil, snapshot, courseCode, currentQuarter)
 		if err != nil {
-			libhttp.HandleErrorJson(w, err)
+			handleError(w, r, err)
 			return
 		}
 		_, err, exists = models.NewUserCoursePair(db).AddUserCoursePair(nil, requestedCourse.ID, currentUser.ID)
 		if err != nil {
-			libhttp.HandleErrorJson(w, err)
+			handleError(w, r, err)
 			return
 		}
 	}
@@ -260,14 +318,89 @@ func PutTerm(w http.ResponseWriter, r *http.Request) {
 	// Get current list of requested courses for the user for the given term.
 	courses, err := models.NewCourse(db).GetCoursesByUserIdAndQuarter(nil, currentUser.ID, currentQuarter)
 	if err != nil {
-		libhttp.HandleErrorJson(w, err)
+		handleError(w, r, err)
 		return
 	}
 	structResponse.Courses = *courses
 
-	jsonResponse, err := json.Marshal(structResponse)
+	writeTermResponse(w, r, structResponse)
+}
+func PutTermRule(w http.ResponseWriter, r *http.Request) {
+	// Replace the rule deciding which changes of a course the user is notified of
+	w.Header().Set("Content-Type", "application/json")
+	quarter := mux.Vars(r)["quarter"]
+	courseCode := mux.Vars(r)["courseCode"]
+	currentUser := getCurrentUser(w, r)
+	if currentUser == nil {
+		http.Redirect(w, r, "/logout", 302)
+		return
+	}
+
+	db := context.Get(r, "db").(*sqlx.DB)
+
+	// statuses is a comma separated list of status codes such as "open,waitlist"
+	rule := models.WatchRule{}
+	for _, code := range strings.Split(r.FormValue("statuses"), ",") {
+		code = strings.TrimSpace(code)
+		if code == "" {
+			continue
+		}
+		status, ok := models.StatusFromCode(code)
+		if !ok || !rules.IsCourseStatus(status) {
+			writeTermResponse(w, r, PutDeleteTermResponse{Status: models.INVALID})
+			return
+		}
+		rule.Statuses = append(rule.Statuses, int64(status))
+	}
+	if minSeats := r.FormValue("minSeats"); minSeats != "" {
+		var err error
+		rule.MinSeats, err = strconv.Atoi(minSeats)
+		if err != nil || rule.MinSeats < 0 {
+			writeTermResponse(w, r, PutDeleteTermResponse{Status: models.INVALID})
+			return
+		}
+	}
+	rule.Waitlist = r.FormValue("waitlist") == "true"
+	rule.Closed = r.FormValue("closed") == "true"
+
+	found, err := models.NewUserCoursePair(db).UpdateRule(nil, currentUser.ID, courseCode, quarter, rule)
 	if err != nil {
-		libhttp.HandleErrorJson(w, err)
+		handleError(w, r, err)
+		return
+	}
+	if !found {
+		writeTermResponse(w, r, PutDeleteTermResponse{Status: models.NOTDELETED})
+		return
+	}
+
+	jsonResponse, err := json.Marshal(rule)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	w.Write(jsonResponse)
+}
+func GetTermCourses(w http.ResponseWriter, r *http.Request) {
+	// List the courses the user requested for a given term
+	w.Header().Set("Content-Type", "application/json")
+	currentQuarter := mux.Vars(r)["quarter"]
+	currentUser := getCurrentUser(w, r)
+	if currentUser == nil {
+		http.Redirect(w, r, "/logout", 302)
+		return
+	}
+
+	db := context.Get(r, "db").(*sqlx.DB)
+
+	courses, err := models.NewCourse(db).GetCoursesByUserIdAndQuarter(nil, currentUser.ID, currentQuarter)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(TermCoursesResponse{Courses: *courses})
+	if err != nil {
+		handleError(w, r, err)
 		return
 	}
 	w.Write(jsonResponse)
@@ -279,8 +412,8 @@ func GetUciClass(w http.ResponseWriter, r *http.Request) {
 	sessionStore := context.Get(r, "sessionStore").(sessions.Store)
 
 	session, _ := sessionStore.Get(r, "server1-session")
-	currentUser, ok := session.Values["user"].(*models.UserRow)
-	if !ok {
+	currentUser := getCurrentUser(w, r)
+	if currentUser == nil {
 		http.Redirect(w, r, "/logout", 302)
 		return
 	}
@@ -291,24 +424,36 @@ func GetUciClass(w http.ResponseWriter, r *http.Request) {
 	possibleQuarters := PossibleQuarters(now)
 
 	// Validate currentQuarter
-	var currentQuarter string
-	currentQuarter, ok = session.Values["currentQuarter"].(string)
+	currentQuarter, ok := session.Values["currentQuarter"].(string)
 	if !ok || !Contains(possibleQuarters, currentQuarter) {
 		currentQuarter = CurrentQuarter(now)
 		session.Values["currentQuarter"] = currentQuarter
 		err := session.Save(r, w)
 		if err != nil {
-			libhttp.HandleErrorJson(w, err)
+			handleError(w, r, err)
 			return
 		}
 	}
 
+	db := context.Get(r, "db").(*sqlx.DB)
+	settings, err := models.NewUser(db).GetSettings(nil, currentUser.ID)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	if !settings.Verified {
+		// New users and users who changed their address land here, so this is where they are sent a verification email
+		if err := sendVerificationEmailIfNeeded(db, currentUser, notify.UserLocale(settings)); err != nil {
+			getLogger(r).Error("account: failed to send verification email", "user_id", currentUser.ID, "err", err)
+		}
+	}
+
 	// Get list of users requested courses
 	/*
 		db := context.Get(r, "db").(*sqlx.DB)
 		courses, err := models.NewCourse(db).GetCoursesByUserIdAndQuarter(nil, currentUser.ID, currentQuarter)
 		if err != nil {
-			libhttp.HandleErrorJson(w, err)
+			handleError(w, r, err)
 			return
 		}
 	*/
@@ -344,15 +489,24 @@ func GetUciClass(w http.ResponseWriter, r *http.Request) {
 		Next                   string
 		ExistsPrev             bool
 		ExistsNext             bool
+		Locale                 string
+		Locales                map[string]string
+		Unsubscribed           bool
+		Digest                 bool
+		Verified               bool
+		DeletionScheduledFor   *time.Time
 	}{
-		currentUser, currentQuarter, ReadableQuarter(currentQuarter), prev, next, prev != "", next != "",
+		currentUser, currentQuarter, ReadableQuarter(currentQuarter), prev, next, prev != "", next != "", notify.UserLocale(settings), notify.LocaleNames, settings.UnsubscribedAt != nil, settings.Digest, settings.Verified,
+		deletionScheduledFor(settings.DeletionRequestedAt),
 	}
 
-	tmpl, err := template.ParseFiles("templates/dashboard.html.tmpl", "templates/uci.html.tmpl")
+	tmpl, err := template.ParseFiles("templates/dashboard.html.tmpl", "templates/uci.html.tmpl", "templates/status.js.tmpl")
 	if err != nil {
-		libhttp.HandleErrorJson(w, err)
+		handleError(w, r, err)
 		return
 	}
 
-	tmpl.Execute(w, data)
+	if err = tmpl.Execute(w, data); err != nil {
+		getLogger(r).Error("failed to render template", "template", "templates/uci.html.tmpl", "err", err)
+	}
 }
@@ -0,0 +1,140 @@
+// Package links signs the URLs in notification emails that act on a user's behalf without a session.
+//
+// A token carries the action, the user, the course and an expiry time, and is signed with
+// HMAC-SHA256 so that it cannot be forged or altered.
+package links
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Actions of tokens.
+const (
+	// StopWatching removes the user's watch of the course.
+	StopWatching = "stop"
+	// Snooze pauses the notifications of the user's watch of the course for SnoozeFor.
+	Snooze = "snooze"
+	// Unsubscribe stops all course alerts to the user. Its tokens have no course.
+	Unsubscribe = "unsubscribe"
+)
+
+const (
+	// TTL is how long the links of an email keep working.
+	TTL = 30 * 24 * time.Hour
+	// SnoozeFor is how long a snooze link pauses notifications.
+	SnoozeFor = 24 * time.Hour
+	// MinSecretLength is the least number of bytes of a signing secret.
+	MinSecretLength = 32
+)
+
+var (
+	// ErrInvalidToken is returned for tokens that are malformed or whose signature does not match.
+	ErrInvalidToken = errors.New("links: invalid token")
+	// ErrExpiredToken is returned for tokens past their expiry time.
+	ErrExpiredToken = errors.New("links: expired token")
+)
+
+// Claims are what a token allows.
+type Claims struct {
+	Action    string
+	UserID    int64
+	CourseID  int64
+	ExpiresAt time.Time
+}
+
+// Signer creates and verifies tokens and the URLs carrying them.
+type Signer struct {
+	baseURL string
+	secret  []byte
+}
+
+// Default is used by the notification emails and the landing pages. It is configured by application.New,
+// and verifies no token until then.
+var Default = &Signer{}
+
+// New returns a Signer whose URLs start with baseURL, such as https://apps.jpatrickpark.com.
+// baseURL must be an absolute http or https URL, since the URLs are opened from emails,
+// and secret must be at least MinSecretLength bytes, since anyone could forge tokens signed with a short one.
+func New(baseURL string, secret []byte) (*Signer, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("links: the base URL %q is not an absolute http or https URL", baseURL)
+	}
+	if len(secret) < MinSecretLength {
+		return nil, fmt.Errorf("links: the secret must be at least %v bytes", MinSecretLength)
+	}
+	return &Signer{baseURL: strings.TrimSuffix(baseURL, "/"), secret: secret}, nil
+}
+
+// Sign returns the token of the claims.
+func (s *Signer) Sign(claims Claims) string {
+	payload := strings.Join([]string{
+		claims.Action,
+		strconv.FormatInt(claims.UserID, 10),
+		strconv.FormatInt(claims.CourseID, 10),
+		strconv.FormatInt(claims.ExpiresAt.Unix(), 10),
+	}, ".")
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + base64.RawURLEncoding.EncodeToString(s.mac(payload))
+}
+
+// Verify returns the claims of a token signed by s that has not expired at now.
+// A Signer without a secret, such as Default before it is configured, verifies no token.
+func (s *Signer) Verify(token string, now time.Time) (Claims, error) {
+	if len(s.secret) == 0 {
+		return Claims{}, ErrInvalidToken
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return Claims{}, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, s.mac(string(payload))) {
+		return Claims{}, ErrInvalidToken
+	}
+
+	fields := strings.Split(string(payload), ".")
+	if len(fields) != 4 {
+		return Claims{}, ErrInvalidToken
+	}
+	claims := Claims{Action: fields[0]}
+	var expiresAt int64
+	for i, dest := range []*int64{&claims.UserID, &claims.CourseID, &expiresAt} {
+		if *dest, err = strconv.ParseInt(fields[i+1], 10, 64); err != nil {
+			return Claims{}, ErrInvalidToken
+		}
+	}
+	claims.ExpiresAt = time.Unix(expiresAt, 0)
+	if now.After(claims.ExpiresAt) {
+		return claims, ErrExpiredToken
+	}
+	return claims, nil
+}
+
+// URL returns the landing page URL of a token for the action that expires TTL from now.
+func (s *Signer) URL(action string, userId, courseId int64) string {
+	token := s.Sign(Claims{Action: action, UserID: userId, CourseID: courseId, ExpiresAt: time.Now().Add(TTL)})
+	return fmt.Sprintf("%v/my-uci-class-is-full/links/%v", s.baseURL, token)
+}
+
+// Absolute returns the URL of the path of this app, such as /verify-email/{token}.
+func (s *Signer) Absolute(path string) string {
+	return s.baseURL + path
+}
+
+func (s *Signer) mac(payload string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,58 @@
+package links
+
+import (
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func TestNewRejectsUnsafeConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		secret  string
+	}{
+		{"no base URL", "", testSecret},
+		{"relative base URL", "/my-uci-class-is-full", testSecret},
+		{"base URL without host", "https://", testSecret},
+		{"no secret", "https://apps.jpatrickpark.com", ""},
+		{"short secret", "https://apps.jpatrickpark.com", "secret"},
+	}
+	for _, test := range tests {
+		if _, err := New(test.baseURL, []byte(test.secret)); err == nil {
+			t.Errorf("%v: New returned no error", test.name)
+		}
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	signer, err := New("https://apps.jpatrickpark.com/", []byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	claims := Claims{Action: Snooze, UserID: 7, CourseID: 42, ExpiresAt: now.Add(TTL).Truncate(time.Second)}
+	token := signer.Sign(claims)
+
+	if got, err := signer.Verify(token, now); err != nil || got != claims {
+		t.Errorf("Verify = %+v, %v; want %+v", got, err, claims)
+	}
+	if _, err := signer.Verify(token, now.Add(TTL+time.Second)); err != ErrExpiredToken {
+		t.Errorf("Verify of an expired token returned %v; want ErrExpiredToken", err)
+	}
+
+	other, err := New("https://apps.jpatrickpark.com", []byte(testSecret+"!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Verify(token, now); err != ErrInvalidToken {
+		t.Errorf("Verify with another secret returned %v; want ErrInvalidToken", err)
+	}
+
+	// An unconfigured Signer would accept tokens signed with an empty key
+	unconfigured := &Signer{}
+	if _, err := unconfigured.Verify(unconfigured.Sign(claims), now); err != ErrInvalidToken {
+		t.Errorf("Verify of an unconfigured Signer returned %v; want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,102 @@
+// Package metrics defines the Prometheus metrics of the app, served at /metrics.
+package metrics
+
+import (
+	"log/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "myuci"
+
+var (
+	// PollCycleDuration is how long a cycle of the poller took to check every active course.
+	PollCycleDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "poll_cycle_duration_seconds",
+		Help:      "Time a cycle of the poller took to check every active course.",
+		Buckets:   []float64{1, 5, 10, 30, 60, 120, 300, 600},
+	})
+	// CoursesChecked counts the courses the poller checked by result, "ok" or "failed".
+	CoursesChecked = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "poll_courses_checked_total",
+		Help:      "Courses checked by the poller, by result.",
+	}, []string{"result"})
+	// StatusTransitions counts the recorded changes of course statuses by their status codes.
+	StatusTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "course_status_transitions_total",
+		Help:      "Recorded changes of course statuses, by old and new status.",
+	}, []string{"from", "to"})
+	// WebSocRequestDuration is how long single requests to WebSoc took, failed ones included and retries counting separately.
+	WebSocRequestDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "websoc_request_duration_seconds",
+		Help:      "Time single requests to WebSoc took.",
+		Buckets:   prometheus.DefBuckets,
+	})
+	// WebSocErrors counts the failed requests to WebSoc by kind: "network", "status", "read" or "circuit_open".
+	WebSocErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websoc_errors_total",
+		Help:      "Failed requests to WebSoc, by kind.",
+	}, []string{"kind"})
+	// Notifications counts the emails handed to the mailer by channel, the SendGrid category such as "CourseAlert",
+	// and result, "sent" or "failed".
+	Notifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_total",
+		Help:      "Emails handed to the mailer, by channel and result.",
+	}, []string{"channel", "result"})
+	// HTTPRequests counts the requests served by route template, method and status code.
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served, by route, method and status code.",
+	}, []string{"route", "method", "code"})
+	// HTTPRequestDuration is how long requests took to serve by route template and method.
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time HTTP requests took to serve, by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+)
+
+func init() {
+	prometheus.MustRegister(PollCycleDuration, CoursesChecked, StatusTransitions, WebSocRequestDuration, WebSocErrors,
+		Notifications, HTTPRequests, HTTPRequestDuration)
+}
+
+// WatchesCollector reports the active watches of every quarter when Prometheus scrapes the app.
+type WatchesCollector struct {
+	desc    *prometheus.Desc
+	watches func() (map[string]int64, error)
+}
+
+// NewWatchesCollector returns a collector that reports the watches per quarter returned by watches.
+func NewWatchesCollector(watches func() (map[string]int64, error)) *WatchesCollector {
+	return &WatchesCollector{
+		desc:    prometheus.NewDesc(namespace+"_active_watches", "Courses watched by users, by quarter.", []string{"quarter"}, nil),
+		watches: watches,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *WatchesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector.
+func (c *WatchesCollector) Collect(ch chan<- prometheus.Metric) {
+	watches, err := c.watches()
+	if err != nil {
+		slog.Error("metrics: failed to count watches", "err", err)
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	for quarter, count := range watches {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(count), quarter)
+	}
+}
@@ -0,0 +1,88 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/jpatrickpark/server1/models"
+)
+
+// IsAdmin reports whether the user is one of the operators listed in adminEmails, ignoring case.
+// The user must have verified the address, so that signing up with or changing to a listed address is not enough.
+func IsAdmin(db *sqlx.DB, user *models.UserRow, adminEmails []string) (bool, error) {
+	if user == nil {
+		return false, nil
+	}
+	listed := false
+	for _, email := range adminEmails {
+		if strings.EqualFold(email, user.Email) {
+			listed = true
+			break
+		}
+	}
+	if !listed {
+		return false, nil
+	}
+
+	settings, err := models.NewUser(db).GetSettings(nil, user.ID)
+	if err != nil {
+		return false, err
+	}
+	return settings.Verified, nil
+}
+
+// isAdmin is IsAdmin for the current user of the request, which answers 500 and returns false when the lookup fails.
+func isAdmin(res http.ResponseWriter, req *http.Request, adminEmails []string) bool {
+	db := context.Get(req, "db").(*sqlx.DB)
+	admin, err := IsAdmin(db, CurrentUser(req), adminEmails)
+	if err != nil {
+		Logger(req).Error("admin: failed to look up the settings of the user", "err", err)
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return false
+	}
+	if !admin {
+		http.Error(res, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	}
+	return admin
+}
+
+// MustAdmin only lets operators listed in adminEmails through and answers 403 to everyone else.
+// It must be used inside MustLogin and after SetDB, SetCurrentUser and SetLogger.
+func MustAdmin(adminEmails []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if !isAdmin(res, req, adminEmails) {
+				return
+			}
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+// MustBeUserOrAdmin only lets the user whose ID is the {id} of the path, or operators listed in adminEmails, through
+// and answers 403 to everyone else, so that users can only change their own account.
+// It must be used inside MustLogin and after SetDB, SetCurrentUser and SetLogger, on a route with an {id} variable.
+func MustBeUserOrAdmin(adminEmails []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			currentUser := CurrentUser(req)
+			id, err := strconv.ParseInt(mux.Vars(req)["id"], 10, 64)
+
+			if currentUser == nil || err != nil {
+				http.Error(res, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			if id != currentUser.ID && !isAdmin(res, req, adminEmails) {
+				return
+			}
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package middlewares
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+
+	"github.com/jpatrickpark/server1/models"
+	"github.com/jpatrickpark/server1/testdb"
+)
+
+func TestIsAdmin(t *testing.T) {
+	db := testdb.New(t, testdb.Users)
+	db.MustExec(`INSERT INTO users (id, email, verified_email) VALUES
+		(1, 'Operator@uci.edu', 'Operator@uci.edu'),
+		(2, 'OTHER@UCI.EDU', 'OTHER@UCI.EDU'),
+		(3, 'operator2@uci.edu', NULL),
+		(4, 'student@uci.edu', 'student@uci.edu')`)
+	adminEmails := []string{"Operator@uci.edu", "other@uci.edu", "operator2@uci.edu"}
+
+	tests := []struct {
+		name string
+		user *models.UserRow
+		want bool
+	}{
+		{"nobody", nil, false},
+		{"verified operator", &models.UserRow{ID: 1, Email: "Operator@uci.edu"}, true},
+		{"verified operator in another case", &models.UserRow{ID: 2, Email: "OTHER@UCI.EDU"}, true},
+		{"unverified operator address", &models.UserRow{ID: 3, Email: "operator2@uci.edu"}, false},
+		{"verified user", &models.UserRow{ID: 4, Email: "student@uci.edu"}, false},
+	}
+	for _, test := range tests {
+		admin, err := IsAdmin(db, test.user, adminEmails)
+		if err != nil {
+			t.Errorf("%v: IsAdmin returned %v", test.name, err)
+			continue
+		}
+		if admin != test.want {
+			t.Errorf("%v: IsAdmin = %v; want %v", test.name, admin, test.want)
+		}
+	}
+
+	if _, err := IsAdmin(db, &models.UserRow{ID: 5, Email: "operator@uci.edu"}, adminEmails); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("IsAdmin of a deleted user returned %v; want sql.ErrNoRows", err)
+	}
+}
+
+func TestMustBeUserOrAdmin(t *testing.T) {
+	db := testdb.New(t, testdb.Users)
+	db.MustExec(`INSERT INTO users (id, email, verified_email) VALUES
+		(1, 'operator@uci.edu', 'operator@uci.edu'),
+		(2, 'student@uci.edu', 'student@uci.edu'),
+		(3, 'operator2@uci.edu', NULL)`)
+	handler := MustBeUserOrAdmin([]string{"operator@uci.edu", "operator2@uci.edu"})(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {}))
+
+	tests := []struct {
+		name string
+		user *models.UserRow
+		id   string
+		want int
+	}{
+		{"nobody", nil, "2", http.StatusForbidden},
+		{"the user", &models.UserRow{ID: 2, Email: "student@uci.edu"}, "2", http.StatusOK},
+		{"another user", &models.UserRow{ID: 2, Email: "student@uci.edu"}, "3", http.StatusForbidden},
+		{"an operator", &models.UserRow{ID: 1, Email: "operator@uci.edu"}, "2", http.StatusOK},
+		{"an unverified operator address", &models.UserRow{ID: 3, Email: "operator2@uci.edu"}, "2", http.StatusForbidden},
+		{"the user with a malformed ID", &models.UserRow{ID: 2, Email: "student@uci.edu"}, "two", http.StatusForbidden},
+	}
+	for _, method := range []string{"POST", "PUT", "DELETE"} {
+		for _, test := range tests {
+			req := httptest.NewRequest(method, "/users/"+test.id, nil)
+			req = mux.SetURLVars(req, map[string]string{"id": test.id})
+			context.Set(req, "db", db)
+			if test.user != nil {
+				context.Set(req, "currentUser", test.user)
+			}
+
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+			context.Clear(req)
+			if res.Code != test.want {
+				t.Errorf("%v /users/%v by %v answered %v; want %v", method, test.id, test.name, res.Code, test.want)
+			}
+		}
+	}
+}
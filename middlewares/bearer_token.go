@@ -0,0 +1,23 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// MustBearerToken only lets requests with the header "Authorization: Bearer <token>" through and answers 401 to
+// everyone else, for callers such as Prometheus that cannot sign in. Nobody is let through when token is empty.
+func MustBearerToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			expected := []byte("Bearer " + token)
+			if token == "" || subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), expected) != 1 {
+				res.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(res, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMustBearerToken(t *testing.T) {
+	ok := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {})
+
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		want          int
+	}{
+		{"the token", "secret", "Bearer secret", http.StatusOK},
+		{"no header", "secret", "", http.StatusUnauthorized},
+		{"another token", "secret", "Bearer guess", http.StatusUnauthorized},
+		{"basic auth", "secret", "Basic c2VjcmV0", http.StatusUnauthorized},
+		{"no token configured", "", "Bearer ", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if test.authorization != "" {
+			req.Header.Set("Authorization", test.authorization)
+		}
+		res := httptest.NewRecorder()
+		MustBearerToken(test.token)(ok).ServeHTTP(res, req)
+		if res.Code != test.want {
+			t.Errorf("%v: answered %v; want %v", test.name, res.Code, test.want)
+		}
+	}
+}
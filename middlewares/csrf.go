@@ -0,0 +1,185 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/context"
+	"github.com/gorilla/sessions"
+)
+
+const (
+	// CSRFCookieName is the cookie that lets scripts read the CSRF token of the session.
+	CSRFCookieName = "csrf_token"
+	// CSRFHeaderName is the header scripts send the token in.
+	CSRFHeaderName = "X-CSRF-Token"
+	// CSRFFieldName is the form field HTML forms send the token in.
+	CSRFFieldName = "csrf_token"
+)
+
+// CSRF refuses state-changing requests that do not carry the CSRF token of the session, or come from another origin,
+// with 403. The token is kept in the session, copied to the csrf_token cookie for scripts and set as "csrfToken".
+// A session without a token gets one with the first HTML page it is served, so that static files and redirects
+// do not create sessions.
+// Requests to originOnlyPaths, whose forms cannot carry the token, must instead come from a page of this site
+// as told by their Origin or Referer.
+// Requests to paths starting with one of exemptPrefixes are let through without a token and without creating one,
+// for callers that authenticate otherwise and for probes that should not create sessions.
+// It must be used after SetSessionStore and SetLogger.
+func CSRF(originOnlyPaths []string, exemptPrefixes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if isExempt(req.URL.Path, exemptPrefixes) {
+				next.ServeHTTP(res, req)
+				return
+			}
+
+			sessionStore := context.Get(req, "sessionStore").(sessions.Store)
+			session, _ := sessionStore.Get(req, "server1-session")
+			token, _ := session.Values["csrfToken"].(string)
+
+			if isSafeMethod(req.Method) {
+				if token == "" {
+					random := make([]byte, 32)
+					if _, err := rand.Read(random); err != nil {
+						Logger(req).Error("csrf: failed to create token", "err", err)
+						http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+						return
+					}
+					token = base64.RawURLEncoding.EncodeToString(random)
+					res = &tokenWriter{ResponseWriter: res, req: req, session: session, token: token}
+				} else {
+					setTokenCookie(res, req, token)
+				}
+				context.Set(req, "csrfToken", token)
+				next.ServeHTTP(res, req)
+				return
+			}
+
+			if !isSameOrigin(req) {
+				http.Error(res, "cross-site request refused", http.StatusForbidden)
+				return
+			}
+			if isOriginOnly(req.URL.Path, originOnlyPaths) {
+				if req.Header.Get("Origin") == "" && req.Header.Get("Referer") == "" {
+					http.Error(res, "missing Origin or Referer", http.StatusForbidden)
+					return
+				}
+				context.Set(req, "csrfToken", token)
+				next.ServeHTTP(res, req)
+				return
+			}
+
+			sent := req.Header.Get(CSRFHeaderName)
+			if sent == "" {
+				sent = req.PostFormValue(CSRFFieldName)
+			}
+			if token == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+				http.Error(res, "missing or invalid CSRF token", http.StatusForbidden)
+				return
+			}
+			context.Set(req, "csrfToken", token)
+
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+// CSRFToken returns the CSRF token set by CSRF, for templates that render forms.
+func CSRFToken(req *http.Request) string {
+	token, _ := context.Get(req, "csrfToken").(string)
+	return token
+}
+
+// tokenWriter saves a new CSRF token in the session when the response turns out to be an HTML page.
+type tokenWriter struct {
+	http.ResponseWriter
+	req     *http.Request
+	session *sessions.Session
+	token   string
+	written bool
+}
+
+func (w *tokenWriter) WriteHeader(status int) {
+	if !w.written {
+		w.written = true
+		if status < 300 && strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+			w.saveToken()
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *tokenWriter) Write(b []byte) (int, error) {
+	if !w.written {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// saveToken keeps the token in the session, unless the handler already gave the session one.
+func (w *tokenWriter) saveToken() {
+	if token, _ := w.session.Values["csrfToken"].(string); token != "" {
+		return
+	}
+	w.session.Values["csrfToken"] = w.token
+	if err := w.session.Save(w.req, w.ResponseWriter); err != nil {
+		Logger(w.req).Error("csrf: failed to save token", "err", err)
+		return
+	}
+	setTokenCookie(w.ResponseWriter, w.req, w.token)
+}
+
+// setTokenCookie makes sure the csrf_token cookie carries the token.
+func setTokenCookie(res http.ResponseWriter, req *http.Request, token string) {
+	if cookie, err := req.Cookie(CSRFCookieName); err != nil || cookie.Value != token {
+		http.SetCookie(res, &http.Cookie{Name: CSRFCookieName, Value: token, Path: "/", Secure: req.TLS != nil})
+	}
+}
+
+func isSafeMethod(method string) bool {
+	return method == "GET" || method == "HEAD" || method == "OPTIONS" || method == "TRACE"
+}
+
+func isOriginOnly(path string, originOnlyPaths []string) bool {
+	for _, originOnly := range originOnlyPaths {
+		if path == originOnly {
+			return true
+		}
+	}
+	return false
+}
+
+func isExempt(path string, exemptPrefixes []string) bool {
+	for _, prefix := range exemptPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSameOrigin reports whether the Origin, or else the Referer, of the request is the host it was sent to.
+// Requests with neither are left to the token check.
+func isSameOrigin(req *http.Request) bool {
+	source := req.Header.Get("Origin")
+	if source == "" || source == "null" {
+		source = req.Header.Get("Referer")
+	}
+	if source == "" {
+		return true
+	}
+
+	u, err := url.Parse(source)
+	if err != nil {
+		return false
+	}
+	return u.Host == req.Host
+}
@@ -0,0 +1,120 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/context"
+	"github.com/gorilla/sessions"
+)
+
+// csrfServer answers with an HTML page, or with a stylesheet under /css/, behind CSRF.
+func csrfServer(store sessions.Store) http.Handler {
+	page := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, "/css/") {
+			res.Header().Set("Content-Type", "text/css; charset=utf-8")
+			res.Write([]byte("body {}"))
+			return
+		}
+		res.Write([]byte("<!DOCTYPE html><html><body>ok</body></html>"))
+	})
+	csrf := CSRF([]string{"/login"}, "/sendgrid/events")(page)
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		context.Set(req, "sessionStore", store)
+		csrf.ServeHTTP(res, req)
+	})
+}
+
+// csrfSession loads a page and returns the cookies and CSRF token of the session it was given.
+func csrfSession(t *testing.T, server http.Handler) ([]*http.Cookie, string) {
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/", nil))
+	var token string
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == CSRFCookieName {
+			token = cookie.Value
+		}
+	}
+	if token == "" {
+		t.Fatal("a page did not set the csrf_token cookie")
+	}
+	return w.Result().Cookies(), token
+}
+
+func TestCSRF(t *testing.T) {
+	server := csrfServer(sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef")))
+	cookies, token := csrfSession(t, server)
+
+	tests := []struct {
+		name   string
+		path   string
+		origin string
+		token  string
+		want   int
+	}{
+		{"the token of the session", "/my-uci-class-is-full/courses", "http://example.com", token, 200},
+		{"the token and no Origin", "/my-uci-class-is-full/courses", "", token, 200},
+		{"the token from another site", "/my-uci-class-is-full/courses", "http://evil.example", token, 403},
+		{"no token", "/my-uci-class-is-full/courses", "http://example.com", "", 403},
+		{"another token", "/my-uci-class-is-full/courses", "http://example.com", "forged", 403},
+		{"a login from this site", "/login", "http://example.com", "", 200},
+		{"a login from another site", "/login", "http://evil.example", "", 403},
+		{"a login without Origin or Referer", "/login", "", "", 403},
+		{"an exempt path from another site", "/sendgrid/events", "http://evil.example", "", 200},
+	}
+	for _, test := range tests {
+		form := url.Values{}
+		if test.token != "" {
+			form.Set(CSRFFieldName, test.token)
+		}
+		req := httptest.NewRequest("POST", "http://example.com"+test.path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		if w.Code != test.want {
+			t.Errorf("POST with %v answered %v; want %v", test.name, w.Code, test.want)
+		}
+	}
+
+	// The token is also accepted in the header scripts send it in
+	req := httptest.NewRequest("DELETE", "http://example.com/my-uci-class-is-full/courses/1", nil)
+	req.Header.Set(CSRFHeaderName, token)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Errorf("DELETE with the token in %v answered %v; want 200", CSRFHeaderName, w.Code)
+	}
+}
+
+func TestCSRFWithoutSession(t *testing.T) {
+	server := csrfServer(sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef")))
+
+	// A state-changing request of a browser that was never served a page has no token to match
+	req := httptest.NewRequest("POST", "http://example.com/my-uci-class-is-full/courses", nil)
+	req.Header.Set("Origin", "http://example.com")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != 403 {
+		t.Errorf("POST without a session answered %v; want 403", w.Code)
+	}
+
+	// Static files are served without creating a session
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/css/site.css", nil))
+	if cookies := w.Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("a stylesheet set %v cookies; want none", len(cookies))
+	}
+}
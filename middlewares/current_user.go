@@ -0,0 +1,41 @@
+package middlewares
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gorilla/context"
+	"github.com/gorilla/sessions"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/jpatrickpark/server1/models"
+)
+
+// SetCurrentUser reloads the signed in user from the database for every request and sets it as "currentUser",
+// so that a changed address takes effect at once and a deleted account is signed out.
+// "currentUser" is not set when nobody is signed in or the account no longer exists.
+// It must be used after SetDB, SetSessionStore and SetLogger.
+func SetCurrentUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		sessionStore := context.Get(req, "sessionStore").(sessions.Store)
+		session, _ := sessionStore.Get(req, "server1-session")
+
+		if sessionUser, ok := session.Values["user"].(*models.UserRow); ok {
+			db := context.Get(req, "db").(*sqlx.DB)
+			user, err := models.NewUser(db).GetById(nil, sessionUser.ID)
+			if err == nil {
+				context.Set(req, "currentUser", user)
+			} else if err != sql.ErrNoRows {
+				Logger(req).Error("session: failed to load user", "user_id", sessionUser.ID, "err", err)
+			}
+		}
+
+		next.ServeHTTP(res, req)
+	})
+}
+
+// CurrentUser returns the user set by SetCurrentUser, or nil if nobody is signed in.
+func CurrentUser(req *http.Request) *models.UserRow {
+	user, _ := context.Get(req, "currentUser").(*models.UserRow)
+	return user
+}
@@ -0,0 +1,61 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+)
+
+// RequestIDHeader is the header a request ID is taken from and answered in.
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDPattern is what a request ID set by a proxy must look like to be kept.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// NewCorrelationID returns a random ID that ties together the log records of a request or a poll cycle.
+func NewCorrelationID() string {
+	random := make([]byte, 8)
+	rand.Read(random)
+	return hex.EncodeToString(random)
+}
+
+// RequestID sets the ID of the request as "requestID" and answers it in the X-Request-ID header.
+// The ID a proxy sent in X-Request-ID is kept, and a new one is made otherwise.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = NewCorrelationID()
+		}
+		context.Set(req, "requestID", id)
+		res.Header().Set(RequestIDHeader, id)
+
+		next.ServeHTTP(res, req)
+	})
+}
+
+// SetLogger sets the logger, with the ID, method and route of the request, as "logger".
+// The route is the path template of the router, as in Metrics, since paths may carry tokens from emails.
+// It must be used after RequestID.
+func SetLogger(logger *slog.Logger, router *mux.Router) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			requestID, _ := context.Get(req, "requestID").(string)
+			context.Set(req, "logger", logger.With("request_id", requestID, "method", req.Method, "route", routeTemplate(router, req)))
+			next.ServeHTTP(res, req)
+		})
+	}
+}
+
+// Logger returns the logger set by SetLogger, or the default logger outside of a request.
+func Logger(req *http.Request) *slog.Logger {
+	if logger, ok := context.Get(req, "logger").(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
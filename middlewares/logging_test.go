@@ -0,0 +1,37 @@
+package middlewares
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestSetLoggerLogsRouteTemplate(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/reset-password/{token}", func(res http.ResponseWriter, req *http.Request) {}).Methods("GET")
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	handler := RequestID(SetLogger(logger, router)(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		Logger(req).Info("handled")
+	})))
+
+	for _, path := range []string{"/reset-password/secret-token", "/unknown/secret-token"} {
+		logs.Reset()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+		if strings.Contains(logs.String(), "secret-token") {
+			t.Errorf("the log of %v holds its token: %v", path, logs.String())
+		}
+	}
+
+	logs.Reset()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/reset-password/secret-token", nil))
+	if !strings.Contains(logs.String(), "route=/reset-password/{token}") {
+		t.Errorf("the log does not hold the route template: %v", logs.String())
+	}
+}
@@ -0,0 +1,51 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/jpatrickpark/server1/metrics"
+)
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Metrics counts and times the requests by the route template of the router they match,
+// so that IDs and tokens in paths do not become labels. Requests no route matches are labeled "unmatched".
+func Metrics(router *mux.Router) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			route := routeTemplate(router, req)
+
+			started := time.Now()
+			recorder := &statusRecorder{ResponseWriter: res, status: http.StatusOK}
+			next.ServeHTTP(recorder, req)
+
+			metrics.HTTPRequests.WithLabelValues(route, req.Method, strconv.Itoa(recorder.status)).Inc()
+			metrics.HTTPRequestDuration.WithLabelValues(route, req.Method).Observe(time.Since(started).Seconds())
+		})
+	}
+}
+
+// routeTemplate returns the path template of the route of the router the request matches, or "unmatched",
+// so that IDs and tokens in paths do not end up in labels and logs.
+func routeTemplate(router *mux.Router, req *http.Request) string {
+	var match mux.RouteMatch
+	if router.Match(req, &match) && match.Route != nil {
+		if template, err := match.Route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unmatched"
+}
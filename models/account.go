@@ -0,0 +1,150 @@
+package models
+
+import (
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// AccountDeletionGrace is how long after the user asks to delete the account it is deleted,
+// so that the user can change their mind.
+const AccountDeletionGrace = 14 * 24 * time.Hour
+
+// Watch is a course a user watches, as exported to the user.
+type Watch struct {
+	CourseCode   string     `db:"coursecode" json:"courseCode"`
+	Quarter      string     `db:"quarter" json:"quarter"`
+	Status       int        `db:"status" json:"courseStatus"`
+	SnoozedUntil *time.Time `db:"snoozed_until" json:"snoozedUntil"`
+	WatchRule
+}
+
+// NotificationRecord is a notification sent to a user together with the course it was about.
+type NotificationRecord struct {
+	NotificationRow
+	CourseCode string `db:"coursecode" json:"courseCode"`
+	Quarter    string `db:"quarter" json:"quarter"`
+}
+
+// SessionRecord is a session of a user as exported to the user, without its ID and values.
+type SessionRecord struct {
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+	UpdatedAt time.Time `db:"updated_at" json:"updatedAt"`
+	ExpiresAt time.Time `db:"expires_at" json:"expiresAt"`
+}
+
+// EmailTokenRecord is a token sent to a user as exported to the user, without its hash.
+type EmailTokenRecord struct {
+	Email     string     `db:"email" json:"email"`
+	Purpose   string     `db:"purpose" json:"purpose"`
+	CreatedAt time.Time  `db:"created_at" json:"createdAt"`
+	ExpiresAt time.Time  `db:"expires_at" json:"expiresAt"`
+	UsedAt    *time.Time `db:"used_at" json:"usedAt"`
+}
+
+// GetWatchesByUserId returns the courses the user watches in all quarters.
+func (p *UserCoursePair) GetWatchesByUserId(tx *sqlx.Tx, userId int64) ([]Watch, error) {
+	watches := []Watch{}
+	query := fmt.Sprintf("SELECT C.coursecode, C.quarter, C.status, P.snoozed_until, P.notify_statuses, P.min_seats, P.notify_waitlist, P.notify_closed FROM %v P JOIN %v C ON C.id = P.course_id WHERE P.user_id=$1 ORDER BY C.quarter, C.coursecode", p.table, CourseTableName)
+	err := p.db.Select(&watches, query, userId)
+
+	return watches, err
+}
+
+// GetNotificationsByUserId returns the notifications of the user, newest first.
+// Notifications of courses that were deleted since are left out.
+func (n *Notification) GetNotificationsByUserId(tx *sqlx.Tx, userId int64) ([]NotificationRecord, error) {
+	notifications := []NotificationRecord{}
+	query := fmt.Sprintf("SELECT N.*, C.coursecode, C.quarter FROM %v N JOIN %v C ON C.id = N.course_id WHERE N.user_id=$1 ORDER BY N.created_at DESC", n.table, CourseTableName)
+	err := n.db.Select(&notifications, query, userId)
+
+	return notifications, err
+}
+
+// GetSessionsByUserId returns the sessions the user is signed in with.
+func (s *Session) GetSessionsByUserId(tx *sqlx.Tx, userId int64) ([]SessionRecord, error) {
+	sessions := []SessionRecord{}
+	query := fmt.Sprintf("SELECT created_at, updated_at, expires_at FROM %v WHERE user_id=$1 ORDER BY created_at DESC", s.table)
+	err := s.db.Select(&sessions, query, userId)
+
+	return sessions, err
+}
+
+// GetEmailTokensByUserId returns the verification and password reset tokens sent to the user.
+func (e *EmailToken) GetEmailTokensByUserId(tx *sqlx.Tx, userId int64) ([]EmailTokenRecord, error) {
+	tokens := []EmailTokenRecord{}
+	query := fmt.Sprintf("SELECT email, purpose, created_at, expires_at, used_at FROM %v WHERE user_id=$1 ORDER BY created_at DESC", e.table)
+	err := e.db.Select(&tokens, query, userId)
+
+	return tokens, err
+}
+
+// ScheduleDeletion records that the user asked to delete the account at the given time.
+// The account is deleted by DeleteScheduledAccounts once the grace period ends, unless the user cancels it.
+func (u *User) ScheduleDeletion(tx *sqlx.Tx, id int64, requestedAt time.Time) error {
+	data := make(map[string]interface{})
+	data["deletion_requested_at"] = requestedAt
+
+	_, err := u.UpdateByID(tx, data, id)
+	return err
+}
+
+// CancelDeletion keeps the account of a user who asked to delete it.
+func (u *User) CancelDeletion(tx *sqlx.Tx, id int64) error {
+	data := make(map[string]interface{})
+	data["deletion_requested_at"] = nil
+
+	_, err := u.UpdateByID(tx, data, id)
+	return err
+}
+
+// CountScheduledAccounts returns the number of accounts whose deletion was asked for before the given time.
+func (u *User) CountScheduledAccounts(tx *sqlx.Tx, before time.Time) (int64, error) {
+	var count int64
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %v WHERE deletion_requested_at < $1", u.table)
+	err := u.db.Get(&count, query, before)
+
+	return count, err
+}
+
+// DeleteScheduledAccounts deletes the accounts whose deletion was asked for before the given time,
+// together with their user-course pairs, notifications, email tokens and sessions, and returns how many it deleted.
+// Courses that lose their last watcher start their grace period.
+func (u *User) DeleteScheduledAccounts(tx *sqlx.Tx, before time.Time) (int64, error) {
+	tx, wrapInSingleTransaction, err := u.newTransactionIfNeeded(tx)
+	if err != nil {
+		return 0, err
+	}
+	if wrapInSingleTransaction {
+		defer tx.Rollback()
+	}
+
+	scheduled := fmt.Sprintf("SELECT id FROM %v WHERE deletion_requested_at < $1", u.table)
+	for _, table := range []string{PairTableName, NotificationTableName, EmailTokenTableName, SessionTableName} {
+		query := fmt.Sprintf("DELETE FROM %v WHERE user_id IN (%v)", table, scheduled)
+		if _, err = tx.Exec(query, before); err != nil {
+			return 0, err
+		}
+	}
+
+	query := fmt.Sprintf("UPDATE %v C SET unwatched_at=$1 WHERE C.unwatched_at IS NULL AND NOT EXISTS (SELECT 1 FROM %v P WHERE P.course_id = C.id)", CourseTableName, PairTableName)
+	if _, err = tx.Exec(query, time.Now()); err != nil {
+		return 0, err
+	}
+
+	query = fmt.Sprintf("DELETE FROM %v WHERE deletion_requested_at < $1", u.table)
+	result, err := tx.Exec(query, before)
+	if err != nil {
+		return 0, err
+	}
+	users, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if wrapInSingleTransaction {
+		err = tx.Commit()
+	}
+
+	return users, err
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"time"
+)
+
+// userTableName is the table of User, as set by NewUser.
+const userTableName = "users"
+
+// AdminUserRow is a user as listed to operators.
+type AdminUserRow struct {
+	ID                  int64      `db:"id"`
+	Email               string     `db:"email"`
+	Verified            bool       `db:"verified"`
+	Undeliverable       bool       `db:"undeliverable"`
+	UnsubscribedAt      *time.Time `db:"unsubscribed_at"`
+	Digest              bool       `db:"digest"`
+	DeletionRequestedAt *time.Time `db:"deletion_requested_at"`
+	Watches             int64      `db:"watches"`
+}
+
+// QuarterWatches counts the watched courses of a quarter and the watches of their users.
+type QuarterWatches struct {
+	Quarter string `db:"quarter"`
+	Courses int64  `db:"courses"`
+	Watches int64  `db:"watches"`
+}
+
+// WatchedCourse is a course together with the number of users watching it.
+type WatchedCourse struct {
+	CourseRow
+	Watchers int64 `db:"watchers"`
+}
+
+// OutboxRecord is a notification together with the course it was about and the address it went to.
+type OutboxRecord struct {
+	NotificationRecord
+	Email string `db:"email"`
+}
+
+// AdminUsers returns the users whose address contains search, by ID, with the number of courses they watch.
+func (u *User) AdminUsers(tx *sqlx.Tx, search string, limit, offset int) ([]AdminUserRow, error) {
+	users := []AdminUserRow{}
+	query := fmt.Sprintf(`SELECT U.id, U.email, (U.verified_email IS NOT NULL AND U.verified_email = U.email) AS verified,
+		(U.undeliverable_email IS NOT NULL AND U.undeliverable_email = U.email) AS undeliverable, U.unsubscribed_at, U.digest, U.deletion_requested_at,
+		(SELECT COUNT(*) FROM %v P WHERE P.user_id = U.id) AS watches
+		FROM %v U WHERE U.email ILIKE '%%' || $1 || '%%' ORDER BY U.id LIMIT $2 OFFSET $3`, PairTableName, u.table)
+	err := u.db.Select(&users, query, search, limit, offset)
+
+	return users, err
+}
+
+// CountUsers returns the number of users whose address contains search.
+func (u *User) CountUsers(tx *sqlx.Tx, search string) (int64, error) {
+	var count int64
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %v WHERE email ILIKE '%%' || $1 || '%%'", u.table)
+	err := u.db.Get(&count, query, search)
+
+	return count, err
+}
+
+// WatchesByQuarter counts the watched courses and watches of every quarter, newest quarter first.
+func (u *Course) WatchesByQuarter(tx *sqlx.Tx) ([]QuarterWatches, error) {
+	quarters := []QuarterWatches{}
+	query := fmt.Sprintf("SELECT C.quarter, COUNT(DISTINCT C.id) AS courses, COUNT(*) AS watches FROM %v C JOIN %v P ON P.course_id = C.id GROUP BY C.quarter ORDER BY C.quarter DESC", u.table, PairTableName)
+	err := u.db.Select(&quarters, query)
+
+	return quarters, err
+}
+
+// MostWatchedCourses returns the courses with the most watchers among the given quarters.
+func (u *Course) MostWatchedCourses(tx *sqlx.Tx, quarters []string, limit int) ([]WatchedCourse, error) {
+	courses := []WatchedCourse{}
+	query := fmt.Sprintf("SELECT C.*, COUNT(*) AS watchers FROM %v C JOIN %v P ON P.course_id = C.id WHERE C.quarter = ANY($1) GROUP BY C.id ORDER BY watchers DESC, C.id LIMIT $2", u.table, PairTableName)
+	err := u.db.Select(&courses, query, pq.Array(quarters), limit)
+
+	return courses, err
+}
+
+// Outbox returns the latest notifications, whether they were sent, failed or are still being sent, newest first.
+func (n *Notification) Outbox(tx *sqlx.Tx, limit int) ([]OutboxRecord, error) {
+	notifications := []OutboxRecord{}
+	query := fmt.Sprintf("%v ORDER BY N.created_at DESC LIMIT $1", outboxQuery(n.table))
+	err := n.db.Select(&notifications, query, limit)
+
+	return notifications, err
+}
+
+// GetOutboxRecordById returns the notification of the ID together with its course and address.
+func (n *Notification) GetOutboxRecordById(tx *sqlx.Tx, id int64) (*OutboxRecord, error) {
+	notification := &OutboxRecord{}
+	query := fmt.Sprintf("%v WHERE N.id=$1", outboxQuery(n.table))
+	err := n.db.Get(notification, query, id)
+
+	return notification, err
+}
+
+func outboxQuery(table string) string {
+	return fmt.Sprintf("SELECT N.*, C.coursecode, C.quarter, U.email FROM %v N JOIN %v C ON C.id = N.course_id JOIN %v U ON U.id = N.user_id", table, CourseTableName, userTableName)
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+const EmailTokenTableName = "email_tokens"
+
+// Purposes of email tokens.
+const (
+	// VerifyEmailPurpose tokens prove that the user receives mail at the address.
+	VerifyEmailPurpose = "verify_email"
+	// ResetPasswordPurpose tokens let the user choose a new password without signing in.
+	ResetPasswordPurpose = "reset_password"
+)
+
+func NewEmailToken(db *sqlx.DB) *EmailToken {
+	emailToken := &EmailToken{}
+	emailToken.db = db
+	emailToken.table = EmailTokenTableName
+	emailToken.hasID = true
+
+	return emailToken
+}
+
+// EmailTokenRow is a single use token sent to an address. Only the SHA-256 hash of the token is stored.
+type EmailTokenRow struct {
+	ID        int64      `db:"id"`
+	UserID    int64      `db:"user_id"`
+	Email     string     `db:"email"`
+	Purpose   string     `db:"purpose"`
+	TokenHash string     `db:"token_hash"`
+	CreatedAt time.Time  `db:"created_at"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+}
+
+type EmailToken struct {
+	Base
+}
+
+func hashEmailToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateToken records a new token of the purpose for the user's address that expires after ttl, and returns the token.
+func (e *EmailToken) CreateToken(tx *sqlx.Tx, userId int64, email, purpose string, ttl time.Duration) (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(random)
+
+	now := time.Now()
+	data := make(map[string]interface{})
+	data["user_id"] = userId
+	data["email"] = email
+	data["purpose"] = purpose
+	data["token_hash"] = hashEmailToken(token)
+	data["created_at"] = now
+	data["expires_at"] = now.Add(ttl)
+
+	_, err := e.InsertIntoTable(tx, data)
+	return token, err
+}
+
+// LastCreatedAt returns when the last token of the purpose was created for the user's address, or nil if none was.
+func (e *EmailToken) LastCreatedAt(tx *sqlx.Tx, userId int64, email, purpose string) (*time.Time, error) {
+	var createdAt *time.Time
+	query := fmt.Sprintf("SELECT MAX(created_at) FROM %v WHERE user_id=$1 AND email=$2 AND purpose=$3", e.table)
+	err := e.db.Get(&createdAt, query, userId, email, purpose)
+
+	return createdAt, err
+}
+
+// GetValidToken returns the unused and unexpired token of the purpose without using it.
+// It returns sql.ErrNoRows if there is no such token.
+func (e *EmailToken) GetValidToken(tx *sqlx.Tx, token, purpose string) (*EmailTokenRow, error) {
+	emailToken := &EmailTokenRow{}
+	query := fmt.Sprintf("SELECT * FROM %v WHERE token_hash=$1 AND purpose=$2 AND used_at IS NULL AND expires_at > $3", e.table)
+	err := e.db.Get(emailToken, query, hashEmailToken(token), purpose, time.Now())
+
+	return emailToken, err
+}
+
+// UseToken marks the token of the purpose as used and returns it, so that it works only once.
+// It returns sql.ErrNoRows if the token does not exist, is used or has expired.
+func (e *EmailToken) UseToken(tx *sqlx.Tx, token, purpose string) (*EmailTokenRow, error) {
+	emailToken := &EmailTokenRow{}
+	now := time.Now()
+	query := fmt.Sprintf("UPDATE %v SET used_at=$3 WHERE token_hash=$1 AND purpose=$2 AND used_at IS NULL AND expires_at > $3 RETURNING *", e.table)
+	err := e.db.Get(emailToken, query, hashEmailToken(token), purpose, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return emailToken, nil
+}
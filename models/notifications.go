@@ -0,0 +1,82 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+const NotificationTableName = "notifications"
+
+func NewNotification(db *sqlx.DB) *Notification {
+	notification := &Notification{}
+	notification.db = db
+	notification.table = NotificationTableName
+	notification.hasID = true
+
+	return notification
+}
+
+// NotificationRow is an alert about a course for a user.
+// Episode identifies the change of the course that caused it, so each user gets at most one alert of a kind per episode.
+type NotificationRow struct {
+	ID        int64          `db:"id" json:"id"`
+	UserID    int64          `db:"user_id" json:"userId"`
+	CourseID  int64          `db:"course_id" json:"courseId"`
+	Kind      string         `db:"kind" json:"kind"`
+	Status    int            `db:"status" json:"status"`
+	Seats     int            `db:"seats" json:"seats"`
+	Episode   time.Time      `db:"episode" json:"episode"`
+	CreatedAt time.Time      `db:"created_at" json:"createdAt"`
+	SentAt    *time.Time     `db:"sent_at" json:"sentAt"`
+	Error     sql.NullString `db:"error" json:"-"`
+}
+
+type Notification struct {
+	Base
+}
+
+// Claim records a notification before it is sent.
+// It returns nil without an error if the user was already notified of this kind of change in this episode.
+func (n *Notification) Claim(tx *sqlx.Tx, userId, courseId int64, kind string, status, seats int, episode time.Time) (*NotificationRow, error) {
+	notification := &NotificationRow{}
+	query := fmt.Sprintf("INSERT INTO %v (user_id, course_id, kind, status, seats, episode, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (user_id, course_id, kind, episode) DO NOTHING RETURNING *", n.table)
+	err := n.db.Get(notification, query, userId, courseId, kind, status, seats, episode, time.Now())
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return notification, nil
+}
+
+// LastCreatedAt returns when the user was last notified of the given kind of change of the course, or nil if never.
+func (n *Notification) LastCreatedAt(tx *sqlx.Tx, userId, courseId int64, kind string) (*time.Time, error) {
+	var createdAt *time.Time
+	query := fmt.Sprintf("SELECT MAX(created_at) FROM %v WHERE user_id=$1 AND course_id=$2 AND kind=$3", n.table)
+	err := n.db.Get(&createdAt, query, userId, courseId, kind)
+
+	return createdAt, err
+}
+
+// MarkSent records that the notification was delivered to the mailer.
+func (n *Notification) MarkSent(tx *sqlx.Tx, id int64) error {
+	data := make(map[string]interface{})
+	data["sent_at"] = time.Now()
+	data["error"] = nil
+
+	_, err := n.UpdateByID(tx, data, id)
+	return err
+}
+
+// MarkFailed records why the notification could not be sent.
+func (n *Notification) MarkFailed(tx *sqlx.Tx, id int64, sendErr error) error {
+	data := make(map[string]interface{})
+	data["error"] = sendErr.Error()
+
+	_, err := n.UpdateByID(tx, data, id)
+	return err
+}
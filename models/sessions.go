@@ -0,0 +1,83 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+const SessionTableName = "sessions"
+
+func NewSession(db *sqlx.DB) *Session {
+	session := &Session{}
+	session.db = db
+	session.table = SessionTableName
+	session.hasID = false
+
+	return session
+}
+
+// SessionRow is a server side session. The cookie only carries its opaque ID.
+type SessionRow struct {
+	ID        string        `db:"id"`
+	UserID    sql.NullInt64 `db:"user_id"`
+	Data      []byte        `db:"data"`
+	CreatedAt time.Time     `db:"created_at"`
+	UpdatedAt time.Time     `db:"updated_at"`
+	ExpiresAt time.Time     `db:"expires_at"`
+}
+
+type Session struct {
+	Base
+}
+
+// GetValidSession returns the unexpired session of the ID.
+// It returns sql.ErrNoRows if there is no such session, which also means it was revoked.
+func (s *Session) GetValidSession(tx *sqlx.Tx, id string) (*SessionRow, error) {
+	session := &SessionRow{}
+	query := fmt.Sprintf("SELECT * FROM %v WHERE id=$1 AND expires_at > $2", s.table)
+	err := s.db.Get(session, query, id, time.Now())
+
+	return session, err
+}
+
+// SaveSession creates or updates the session of the ID. userId is 0 when nobody is signed in.
+func (s *Session) SaveSession(tx *sqlx.Tx, id string, userId int64, data []byte, expiresAt time.Time) error {
+	user := sql.NullInt64{Int64: userId, Valid: userId != 0}
+	query := fmt.Sprintf(`INSERT INTO %v (id, user_id, data, created_at, updated_at, expires_at) VALUES ($1, $2, $3, $4, $4, $5)
+		ON CONFLICT (id) DO UPDATE SET user_id=EXCLUDED.user_id, data=EXCLUDED.data, updated_at=EXCLUDED.updated_at, expires_at=EXCLUDED.expires_at`, s.table)
+	_, err := s.db.Exec(query, id, user, data, time.Now(), expiresAt)
+
+	return err
+}
+
+// DeleteSession deletes the session of the ID.
+func (s *Session) DeleteSession(tx *sqlx.Tx, id string) error {
+	query := fmt.Sprintf("DELETE FROM %v WHERE id=$1", s.table)
+	_, err := s.db.Exec(query, id)
+
+	return err
+}
+
+// DeleteSessionsByUserId deletes every session of the user, which signs them out everywhere.
+func (s *Session) DeleteSessionsByUserId(tx *sqlx.Tx, userId int64) (int64, error) {
+	query := fmt.Sprintf("DELETE FROM %v WHERE user_id=$1", s.table)
+	result, err := s.db.Exec(query, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// DeleteExpiredSessions deletes the sessions that expired before the time.
+func (s *Session) DeleteExpiredSessions(tx *sqlx.Tx, before time.Time) (int64, error) {
+	query := fmt.Sprintf("DELETE FROM %v WHERE expires_at <= $1", s.table)
+	result, err := s.db.Exec(query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
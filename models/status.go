@@ -0,0 +1,37 @@
+package models
+
+//go:generate go run ../cmd/genstatus
+
+// StatusCode returns the string code of the given status used in JSON responses.
+func StatusCode(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	return "unknown"
+}
+
+// StatusHTTPStatus returns the HTTP status code answered when a PUT or DELETE term request results in the given status.
+func StatusHTTPStatus(status int) int {
+	if httpStatus, ok := statusHTTPStatuses[status]; ok {
+		return httpStatus
+	}
+	return 500
+}
+
+// StatusMessage returns a short English description of the given status.
+func StatusMessage(status int) string {
+	if message, ok := statusMessages[status]; ok {
+		return message
+	}
+	return "An unknown error occurred."
+}
+
+// StatusFromCode returns the status whose string code is the given one.
+func StatusFromCode(code string) (int, bool) {
+	for status, statusCode := range statusCodes {
+		if statusCode == code {
+			return status, true
+		}
+	}
+	return 0, false
+}
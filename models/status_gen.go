@@ -0,0 +1,59 @@
+// Code generated by cmd/genstatus; DO NOT EDIT.
+
+package models
+
+const (
+	FULL             = 0
+	OPEN             = 1
+	WAITLIST         = 2
+	NONEXISTENT      = 3
+	DELETED          = 4
+	ENTRYEXISTS      = 5
+	NOTDELETED       = 6
+	NEWONLY_FULL     = 7
+	NEWONLY_WAITLIST = 8
+	INVALID          = 9
+	UNKNOWN          = 10
+)
+
+var statusCodes = map[int]string{
+	FULL:             "full",
+	OPEN:             "open",
+	WAITLIST:         "waitlist",
+	NONEXISTENT:      "nonexistent",
+	DELETED:          "deleted",
+	ENTRYEXISTS:      "entry_exists",
+	NOTDELETED:       "not_watched",
+	NEWONLY_FULL:     "newonly_full",
+	NEWONLY_WAITLIST: "newonly_waitlist",
+	INVALID:          "invalid_request",
+	UNKNOWN:          "registrar_unavailable",
+}
+
+var statusHTTPStatuses = map[int]int{
+	FULL:             201,
+	OPEN:             201,
+	WAITLIST:         201,
+	NONEXISTENT:      404,
+	DELETED:          200,
+	ENTRYEXISTS:      409,
+	NOTDELETED:       404,
+	NEWONLY_FULL:     201,
+	NEWONLY_WAITLIST: 201,
+	INVALID:          422,
+	UNKNOWN:          502,
+}
+
+var statusMessages = map[int]string{
+	FULL:             "The course is full.",
+	OPEN:             "The course is open.",
+	WAITLIST:         "The course has an open waitlist.",
+	NONEXISTENT:      "The course does not exist.",
+	DELETED:          "The course is no longer watched.",
+	ENTRYEXISTS:      "The course is already watched.",
+	NOTDELETED:       "The course is not watched.",
+	NEWONLY_FULL:     "The course is only available for new students.",
+	NEWONLY_WAITLIST: "The course has an open waitlist for current students.",
+	INVALID:          "The course code or the quarter is not valid.",
+	UNKNOWN:          "The status of the course could not be fetched from WebSoc.",
+}
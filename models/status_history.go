@@ -0,0 +1,53 @@
+package models
+
+import (
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+const StatusHistoryTableName = "course_status_history"
+
+func NewStatusHistory(db *sqlx.DB) *StatusHistory {
+	history := &StatusHistory{}
+	history.db = db
+	history.table = StatusHistoryTableName
+	history.hasID = true
+
+	return history
+}
+
+// StatusHistoryRow is a recorded change of the status of a course.
+type StatusHistoryRow struct {
+	ID         int64     `db:"id" json:"id"`
+	CourseID   int64     `db:"course_id" json:"courseId"`
+	Status     int       `db:"status" json:"status"`
+	MaxSeats   int       `db:"max_seats" json:"maxSeats"`
+	Enrolled   int       `db:"enrolled" json:"enrolled"`
+	Waitlisted int       `db:"waitlisted" json:"waitlisted"`
+	ChangedAt  time.Time `db:"changed_at" json:"changedAt"`
+}
+
+type StatusHistory struct {
+	Base
+}
+
+// Record adds the snapshot a course changed to at changedAt to its history.
+func (h *StatusHistory) Record(tx *sqlx.Tx, courseId int64, snapshot Snapshot, changedAt time.Time) error {
+	data := seatsData(snapshot)
+	data["course_id"] = courseId
+	data["status"] = snapshot.Status
+	data["changed_at"] = changedAt
+
+	_, err := h.InsertIntoTable(tx, data)
+	return err
+}
+
+// ChangesSinceByUserId returns the changes since the given time of the courses the user watches, oldest first.
+func (h *StatusHistory) ChangesSinceByUserId(tx *sqlx.Tx, userId int64, since time.Time) ([]StatusHistoryRow, error) {
+	changes := []StatusHistoryRow{}
+	query := fmt.Sprintf("SELECT H.* FROM %v H, %v P WHERE P.user_id=$1 AND P.course_id=H.course_id AND H.changed_at >= $2 ORDER BY H.changed_at", h.table, PairTableName)
+	err := h.db.Select(&changes, query, userId, since)
+
+	return changes, err
+}
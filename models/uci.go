@@ -5,20 +5,25 @@ import (
 	"errors"
 	"fmt"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"time"
+
+	"github.com/jpatrickpark/server1/websoc"
+)
+
+// Status constants such as FULL and OPEN are generated into status_gen.go.
+const (
+	PairTableName   = "user_course_pair"
+	CourseTableName = "courses"
 )
 
 const (
-	PairTableName    = "user_course_pair"
-	CourseTableName  = "courses"
-	FULL             = 0
-	OPEN             = 1
-	WAITLIST         = 2
-	NONEXISTENT      = 3
-	DELETED          = 4
-	ENTRYEXISTS      = 5
-	NOTDELETED       = 6
-	NEWONLY_FULL     = 7
-	NEWONLY_WAITLIST = 8
+	// PollInterval is how often the poller checks every course.
+	PollInterval = time.Minute
+	// StaleCycles is the number of missed poll cycles after which a course is considered stale.
+	StaleCycles = 5
+	// StaleAfter is how long a course may go unchecked before it is reported as stale.
+	StaleAfter = StaleCycles * PollInterval
 )
 
 func NewCourse(db *sqlx.DB) *Course {
@@ -39,15 +44,72 @@ func NewUserCoursePair(db *sqlx.DB) *UserCoursePair {
 }
 
 type CourseRow struct {
-	ID         int64  `db:"id" json:"courseId"`
-	CourseCode string `db:"coursecode" json:"courseCode"`
-	Status     int    `db:"status" json:"courseStatus"`
-	Quarter    string `db:"quarter" json:"quarter"`
+	ID            int64      `db:"id" json:"courseId"`
+	CourseCode    string     `db:"coursecode" json:"courseCode"`
+	Status        int        `db:"status" json:"courseStatus"`
+	Quarter       string     `db:"quarter" json:"quarter"`
+	LastCheckedAt *time.Time `db:"last_checked_at" json:"lastCheckedAt"`
+	LastChangedAt *time.Time `db:"last_changed_at" json:"lastChangedAt"`
+	UnwatchedAt   *time.Time `db:"unwatched_at" json:"-"`
+	MaxSeats      int        `db:"max_seats" json:"maxSeats"`
+	Enrolled      int        `db:"enrolled" json:"enrolled"`
+	Waitlisted    int        `db:"waitlisted" json:"waitlisted"`
+	PendingStatus *int       `db:"pending_status" json:"-"`
+	PendingChecks int        `db:"pending_checks" json:"-"`
+	Stale         bool       `db:"stale" json:"stale"`
 }
 type UserCoursePairRow struct {
-	ID       int64 `db:"id"`
-	CourseID int64 `db:"course_id"`
-	UserID   int64 `db:"user_id"`
+	ID           int64      `db:"id"`
+	CourseID     int64      `db:"course_id"`
+	UserID       int64      `db:"user_id"`
+	SnoozedUntil *time.Time `db:"snoozed_until"`
+	WatchRule
+}
+
+// IsSnoozed reports whether the user paused the notifications of the pair at now.
+func (p *UserCoursePairRow) IsSnoozed(now time.Time) bool {
+	return p.SnoozedUntil != nil && now.Before(*p.SnoozedUntil)
+}
+
+// Snapshot is the state of a course as seen by one check of WebSoc.
+// Seat counts that WebSoc does not show are -1.
+type Snapshot struct {
+	Status     int
+	MaxSeats   int
+	Enrolled   int
+	Waitlisted int
+	// Section is the parsed WebSoc row of the course. It is nil when the course was not found
+	// and for snapshots read from the database, which only keep the status and seat counts.
+	Section *websoc.Section
+}
+
+// SeatsAvailable returns the number of open seats, which is never negative.
+func (s Snapshot) SeatsAvailable() int {
+	if s.MaxSeats < 0 || s.Enrolled < 0 || s.Enrolled >= s.MaxSeats {
+		return 0
+	}
+	return s.MaxSeats - s.Enrolled
+}
+
+// Snapshot returns the state of the course recorded by the last check.
+func (c *CourseRow) Snapshot() Snapshot {
+	return Snapshot{Status: c.Status, MaxSeats: c.MaxSeats, Enrolled: c.Enrolled, Waitlisted: c.Waitlisted}
+}
+
+// WatchRule decides which changes of a course a user is notified of.
+// Statuses are the statuses the user wants to hear about when the course enters them; empty means the default ones.
+// MinSeats, when positive, notifies when at least that many seats become available.
+// Waitlist notifies when a waitlist opens, and Closed notifies when an available course becomes full again.
+type WatchRule struct {
+	Statuses pq.Int64Array `db:"notify_statuses" json:"statuses"`
+	MinSeats int           `db:"min_seats" json:"minSeats"`
+	Waitlist bool          `db:"notify_waitlist" json:"waitlist"`
+	Closed   bool          `db:"notify_closed" json:"closed"`
+}
+
+// IsStale reports whether the course has not been checked successfully within StaleAfter.
+func (c *CourseRow) IsStale(now time.Time) bool {
+	return c.LastCheckedAt == nil || now.Sub(*c.LastCheckedAt) > StaleAfter
 }
 
 type Course struct {
@@ -99,6 +161,120 @@ func (u *Course) AllCourses(tx *sqlx.Tx) ([]*CourseRow, error) {
 	return courses, err
 }
 
+// ActiveCourses returns the course rows of the given quarters that at least one user watches.
+func (u *Course) ActiveCourses(tx *sqlx.Tx, quarters []string) ([]*CourseRow, error) {
+	courses := []*CourseRow{}
+	query := fmt.Sprintf("SELECT * FROM %v C WHERE C.quarter = ANY($1) AND EXISTS (SELECT 1 FROM %v P WHERE P.course_id = C.id)", u.table, PairTableName)
+	err := u.db.Select(&courses, query, pq.Array(quarters))
+
+	return courses, err
+}
+
+// CountCoursesBeforeQuarter returns the number of courses of quarters before the given quarter and the number of their user-course pairs.
+func (u *Course) CountCoursesBeforeQuarter(tx *sqlx.Tx, quarter string) (int64, int64, error) {
+	var courses, pairs int64
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %v WHERE quarter < $1", u.table)
+	err := u.db.Get(&courses, query, quarter)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	query = fmt.Sprintf("SELECT COUNT(*) FROM %v P, %v C WHERE C.quarter < $1 AND C.id = P.course_id", PairTableName, u.table)
+	err = u.db.Get(&pairs, query, quarter)
+
+	return courses, pairs, err
+}
+
+// DeleteCoursesBeforeQuarter deletes the courses of quarters before the given quarter together with their user-course pairs.
+// It returns the number of deleted courses and pairs.
+func (u *Course) DeleteCoursesBeforeQuarter(tx *sqlx.Tx, quarter string) (int64, int64, error) {
+	tx, wrapInSingleTransaction, err := u.newTransactionIfNeeded(tx)
+	if tx == nil {
+		return 0, 0, errors.New("Transaction struct must not be empty.")
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	if wrapInSingleTransaction {
+		defer tx.Rollback()
+	}
+
+	query := fmt.Sprintf("DELETE FROM %v P USING %v C WHERE C.quarter < $1 AND C.id = P.course_id", PairTableName, u.table)
+	result, err := tx.Exec(query, quarter)
+	if err != nil {
+		return 0, 0, err
+	}
+	pairs, err := result.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	query = fmt.Sprintf("DELETE FROM %v WHERE quarter < $1", u.table)
+	result, err = tx.Exec(query, quarter)
+	if err != nil {
+		return 0, 0, err
+	}
+	courses, err := result.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if wrapInSingleTransaction {
+		err = tx.Commit()
+	}
+
+	return courses, pairs, err
+}
+
+// MarkUnwatchedCourses records the current time as unwatched_at of the courses nobody watches that are not marked yet.
+func (u *Course) MarkUnwatchedCourses(tx *sqlx.Tx) (int64, error) {
+	data := make(map[string]interface{})
+	data["unwatched_at"] = time.Now()
+
+	result, err := u.UpdateFromTable(tx, data, fmt.Sprintf("unwatched_at IS NULL AND NOT EXISTS (SELECT 1 FROM %v P WHERE P.course_id = %v.id)", PairTableName, u.table))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CountUnwatchedCourses returns the number of courses nobody has watched since before the given time.
+func (u *Course) CountUnwatchedCourses(tx *sqlx.Tx, before time.Time) (int64, error) {
+	var courses int64
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %v C WHERE C.unwatched_at < $1 AND NOT EXISTS (SELECT 1 FROM %v P WHERE P.course_id = C.id)", u.table, PairTableName)
+	err := u.db.Get(&courses, query, before)
+
+	return courses, err
+}
+
+// DeleteUnwatchedCourses deletes the courses nobody has watched since before the given time.
+func (u *Course) DeleteUnwatchedCourses(tx *sqlx.Tx, before time.Time) (int64, error) {
+	query := fmt.Sprintf("DELETE FROM %v C WHERE C.unwatched_at < $1 AND NOT EXISTS (SELECT 1 FROM %v P WHERE P.course_id = C.id)", u.table, PairTableName)
+	result, err := u.db.Exec(query, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ReviveCourse is used when a course nobody watched is watched again.
+// The poller skipped the course in the meantime, so the given snapshot replaces the recorded one.
+func (u *Course) ReviveCourse(tx *sqlx.Tx, course *CourseRow, snapshot Snapshot) (*CourseRow, error) {
+	data := snapshotData(snapshot)
+	data["last_checked_at"] = time.Now()
+	data["unwatched_at"] = nil
+	if course.Status != snapshot.Status {
+		data["last_changed_at"] = data["last_checked_at"]
+	}
+
+	_, err := u.UpdateByID(tx, data, course.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.GetCourseById(tx, course.ID)
+}
+
 func (p *UserCoursePair) GetPairsByCourseId(tx *sqlx.Tx, courseId int64) (*[]UserCoursePairRow, error) {
 	pairs := &[]UserCoursePairRow{}
 
@@ -112,8 +288,8 @@ func (u *Course) GetCoursesByUserIdAndQuarter(tx *sqlx.Tx, userId int64, quarter
 	courses := &[]CourseRow{}
 
 	//fix P C
-	query := fmt.Sprintf("SELECT courses.id, courses.coursecode, courses.status, courses.quarter FROM %v, %v WHERE user_course_pair.user_id=$1 AND user_course_pair.course_id = courses.id AND courses.quarter=$2", u.table, PairTableName)
-	err := u.db.Select(courses, query, userId, quarter)
+	query := fmt.Sprintf("SELECT courses.id, courses.coursecode, courses.status, courses.quarter, courses.last_checked_at, courses.last_changed_at, courses.max_seats, courses.enrolled, courses.waitlisted, (courses.last_checked_at IS NULL OR courses.last_checked_at < $3) AS stale FROM %v, %v WHERE user_course_pair.user_id=$1 AND user_course_pair.course_id = courses.id AND courses.quarter=$2", u.table, PairTableName)
+	err := u.db.Select(courses, query, userId, quarter, time.Now().Add(-StaleAfter))
 
 	return courses, err
 }
@@ -133,19 +309,143 @@ func (p *UserCoursePair) GetPairByCourseIdAndUserId(tx *sqlx.Tx, courseId, userI
 	return pair, err
 }
 
-func (u *Course) UpdateCourse(tx *sqlx.Tx, courseId int64, status int) {
-	query := fmt.Sprintf("UPDATE %v SET status=$1 WHERE id=$2", u.table)
-	u.db.Exec(query, status, courseId)
+func snapshotData(snapshot Snapshot) map[string]interface{} {
+	data := seatsData(snapshot)
+	data["status"] = snapshot.Status
+	data["pending_status"] = nil
+	data["pending_checks"] = 0
+
+	return data
+}
+
+func seatsData(snapshot Snapshot) map[string]interface{} {
+	data := make(map[string]interface{})
+	data["max_seats"] = snapshot.MaxSeats
+	data["enrolled"] = snapshot.Enrolled
+	data["waitlisted"] = snapshot.Waitlisted
+
+	return data
+}
+
+// UpdateCourse records a snapshot with a new status for the course and marks it as checked and changed at changedAt.
+// The change is also added to the status history of the course.
+func (u *Course) UpdateCourse(tx *sqlx.Tx, courseId int64, snapshot Snapshot, changedAt time.Time) error {
+	tx, wrapInSingleTransaction, err := u.newTransactionIfNeeded(tx)
+	if err != nil {
+		return err
+	}
+	if wrapInSingleTransaction {
+		defer tx.Rollback()
+	}
+
+	data := snapshotData(snapshot)
+	data["last_checked_at"] = changedAt
+	data["last_changed_at"] = changedAt
+
+	if _, err = u.UpdateByID(tx, data, courseId); err != nil {
+		return err
+	}
+	if err = NewStatusHistory(u.db).Record(tx, courseId, snapshot, changedAt); err != nil {
+		return err
+	}
+
+	if wrapInSingleTransaction {
+		err = tx.Commit()
+	}
+	return err
 }
 
-func (p *UserCoursePair) RemoveUserCoursePair(tx *sqlx.Tx, userId int64, code, quarter string) int {
+// TouchCourse records a snapshot with an unchanged status, which may still change the seat counts, and marks the course as checked.
+func (u *Course) TouchCourse(tx *sqlx.Tx, courseId int64, snapshot Snapshot) error {
+	data := snapshotData(snapshot)
+	data["last_checked_at"] = time.Now()
+
+	_, err := u.UpdateByID(tx, data, courseId)
+	return err
+}
+
+// DeferCourse records that the new status of a snapshot has only been seen for pendingChecks checks in a row.
+// The recorded status and seat counts are kept until the new status holds long enough to be recorded with UpdateCourse,
+// so that the change of the seat counts is still seen then.
+func (u *Course) DeferCourse(tx *sqlx.Tx, courseId int64, snapshot Snapshot, pendingChecks int) error {
+	data := make(map[string]interface{})
+	data["pending_status"] = snapshot.Status
+	data["pending_checks"] = pendingChecks
+	data["last_checked_at"] = time.Now()
+
+	_, err := u.UpdateByID(tx, data, courseId)
+	return err
+}
+
+// RemoveUserCoursePair deletes the user's pair for the given course.
+// It returns DELETED if a pair was removed and NOTDELETED if the user did not watch the course.
+func (p *UserCoursePair) RemoveUserCoursePair(tx *sqlx.Tx, userId int64, code, quarter string) (int, error) {
+	tx, wrapInSingleTransaction, err := p.newTransactionIfNeeded(tx)
+	if err != nil {
+		return NOTDELETED, err
+	}
+	if wrapInSingleTransaction {
+		defer tx.Rollback()
+	}
+
 	query := fmt.Sprintf("DELETE FROM %v P USING %v C WHERE P.user_id=$1 AND C.coursecode=$2 AND C.quarter=$3 AND C.id=P.course_id", p.table, CourseTableName)
-	_, err := p.db.Exec(query, userId, code, quarter)
+	result, err := tx.Exec(query, userId, code, quarter)
+	if err != nil {
+		return NOTDELETED, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return NOTDELETED, err
+	}
+	if rowsAffected == 0 {
+		return NOTDELETED, nil
+	}
 
+	// Start the grace period of the course if this was its last watcher
+	query = fmt.Sprintf("UPDATE %v C SET unwatched_at=$3 WHERE C.coursecode=$1 AND C.quarter=$2 AND C.unwatched_at IS NULL AND NOT EXISTS (SELECT 1 FROM %v P WHERE P.course_id = C.id)", CourseTableName, p.table)
+	_, err = tx.Exec(query, code, quarter, time.Now())
+	if err != nil {
+		return NOTDELETED, err
+	}
+
+	if wrapInSingleTransaction {
+		err = tx.Commit()
+	}
 	if err != nil {
-		return NOTDELETED
+		return NOTDELETED, err
 	}
-	return DELETED
+	return DELETED, nil
+}
+
+// SnoozePair pauses the notifications of the user's pair for the given course until the given time.
+// It returns false if the user does not watch the course.
+func (p *UserCoursePair) SnoozePair(tx *sqlx.Tx, userId, courseId int64, until time.Time) (bool, error) {
+	data := make(map[string]interface{})
+	data["snoozed_until"] = until
+
+	result, err := p.UpdateFromTable(tx, data, fmt.Sprintf("user_id=%v AND course_id=%v", userId, courseId))
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+// UpdateRule replaces the rule of the user's pair for the given course.
+// It returns false if the user does not watch the course.
+func (p *UserCoursePair) UpdateRule(tx *sqlx.Tx, userId int64, code, quarter string, rule WatchRule) (bool, error) {
+	if rule.Statuses == nil {
+		rule.Statuses = pq.Int64Array{}
+	}
+	query := fmt.Sprintf("UPDATE %v P SET notify_statuses=$1, min_seats=$2, notify_waitlist=$3, notify_closed=$4 FROM %v C WHERE P.user_id=$5 AND C.coursecode=$6 AND C.quarter=$7 AND C.id=P.course_id", p.table, CourseTableName)
+	result, err := p.db.Exec(query, rule.Statuses, rule.MinSeats, rule.Waitlist, rule.Closed, userId, code, quarter)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
 }
 
 func (u *UserCoursePair) AddUserCoursePair(tx *sqlx.Tx, courseId, userId int64) (*UserCoursePairRow, error, bool) {
@@ -173,7 +473,7 @@ func (u *UserCoursePair) AddUserCoursePair(tx *sqlx.Tx, courseId, userId int64)
 	return confirmingEntry, err2, false
 }
 
-func (u *Course) AddCourse(tx *sqlx.Tx, status int, code, quarter string) (*CourseRow, error) {
+func (u *Course) AddCourse(tx *sqlx.Tx, snapshot Snapshot, code, quarter string) (*CourseRow, error) {
 	if code == "" {
 		return nil, errors.New("Code cannot be blank.")
 	}
@@ -182,13 +482,17 @@ func (u *Course) AddCourse(tx *sqlx.Tx, status int, code, quarter string) (*Cour
 	}
 	previousEntry, err0 := u.GetCourseByCourseCodeAndQuarter(nil, code, quarter)
 	if err0 == nil {
+		if previousEntry.UnwatchedAt != nil {
+			return u.ReviveCourse(tx, previousEntry, snapshot)
+		}
 		return previousEntry, nil
 	}
 
-	data := make(map[string]interface{})
+	data := snapshotData(snapshot)
 	data["coursecode"] = code
-	data["status"] = status
 	data["quarter"] = quarter
+	data["last_checked_at"] = time.Now()
+	data["last_changed_at"] = data["last_checked_at"]
 
 	sqlResult, err1 := u.InsertIntoTable(tx, data)
 	if err1 != nil {
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/jpatrickpark/server1/testdb"
+)
+
+func testDB(t *testing.T) *sqlx.DB {
+	return testdb.New(t, testdb.Courses, testdb.UserCoursePairs, testdb.CourseStatusHistory)
+}
+
+func TestUnwatchedCourseIsRevivedAndCollected(t *testing.T) {
+	db := testDB(t)
+	course := NewCourse(db)
+	pair := NewUserCoursePair(db)
+	const userId, code, quarter = 1, "34250", "2016-92"
+
+	// Add: a watched course is never marked as unwatched
+	added, err := course.AddCourse(nil, Snapshot{Status: FULL, MaxSeats: 40, Enrolled: 40, Waitlisted: 0}, code, quarter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err, _ := pair.AddUserCoursePair(nil, added.ID, userId); err != nil {
+		t.Fatal(err)
+	}
+	if marked, err := course.MarkUnwatchedCourses(nil); err != nil || marked != 0 {
+		t.Fatalf("MarkUnwatchedCourses of a watched course = %v, %v; want 0", marked, err)
+	}
+
+	// Remove: the last watcher starts the grace period, and the poller skips the course
+	if status, err := pair.RemoveUserCoursePair(nil, userId, code, quarter); err != nil || status != DELETED {
+		t.Fatalf("RemoveUserCoursePair = %v, %v; want DELETED", StatusCode(status), err)
+	}
+	removed, err := course.GetCourseById(nil, added.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed.UnwatchedAt == nil {
+		t.Fatal("unwatched_at is not set after the last watcher left")
+	}
+	if marked, err := course.MarkUnwatchedCourses(nil); err != nil || marked != 0 {
+		t.Fatalf("MarkUnwatchedCourses of a marked course = %v, %v; want 0", marked, err)
+	}
+	active, err := course.ActiveCourses(nil, []string{quarter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 0 {
+		t.Fatalf("ActiveCourses = %v courses; want the unwatched course skipped", len(active))
+	}
+	if deleted, err := course.DeleteUnwatchedCourses(nil, time.Now().Add(-7*24*time.Hour)); err != nil || deleted != 0 {
+		t.Fatalf("DeleteUnwatchedCourses within the grace period = %v, %v; want 0", deleted, err)
+	}
+
+	// Re-add: the course is revived with the new snapshot instead of the one recorded before it was skipped
+	revived, err := course.AddCourse(nil, Snapshot{Status: OPEN, MaxSeats: 40, Enrolled: 35, Waitlisted: 0}, code, quarter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revived.ID != added.ID {
+		t.Fatalf("AddCourse of an unwatched course created course %v; want %v revived", revived.ID, added.ID)
+	}
+	if revived.UnwatchedAt != nil {
+		t.Fatal("unwatched_at is still set after the course was watched again")
+	}
+	if revived.Status != OPEN || revived.Enrolled != 35 {
+		t.Fatalf("revived course has status %v and %v enrolled; want open and 35", StatusCode(revived.Status), revived.Enrolled)
+	}
+	if revived.LastChangedAt == nil || !revived.LastChangedAt.After(*added.LastChangedAt) {
+		t.Fatal("last_changed_at of the revived course is not the time of the new status")
+	}
+	if _, err, _ := pair.AddUserCoursePair(nil, added.ID, userId); err != nil {
+		t.Fatal(err)
+	}
+	if deleted, err := course.DeleteUnwatchedCourses(nil, time.Now().Add(time.Hour)); err != nil || deleted != 0 {
+		t.Fatalf("DeleteUnwatchedCourses of a watched course = %v, %v; want 0", deleted, err)
+	}
+
+	// Remove again: once the grace period is over the course is deleted
+	if _, err := pair.RemoveUserCoursePair(nil, userId, code, quarter); err != nil {
+		t.Fatal(err)
+	}
+	if deleted, err := course.DeleteUnwatchedCourses(nil, time.Now().Add(time.Hour)); err != nil || deleted != 1 {
+		t.Fatalf("DeleteUnwatchedCourses after the grace period = %v, %v; want 1", deleted, err)
+	}
+	if _, err := course.GetCourseById(nil, added.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetCourseById of a collected course = %v; want sql.ErrNoRows", err)
+	}
+}
+
+func TestMarkUnwatchedCourses(t *testing.T) {
+	db := testDB(t)
+	course := NewCourse(db)
+
+	// Courses left without watchers before unwatched_at existed are marked by the retention job
+	orphan, err := course.AddCourse(nil, Snapshot{Status: OPEN, MaxSeats: -1, Enrolled: -1, Waitlisted: -1}, "34260", "2016-92")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if marked, err := course.MarkUnwatchedCourses(nil); err != nil || marked != 1 {
+		t.Fatalf("MarkUnwatchedCourses = %v, %v; want 1", marked, err)
+	}
+	marked, err := course.GetCourseById(nil, orphan.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if marked.UnwatchedAt == nil {
+		t.Fatal("unwatched_at is not set by MarkUnwatchedCourses")
+	}
+}
+
+func TestDeferCourseKeepsRecordedSnapshot(t *testing.T) {
+	db := testDB(t)
+	course := NewCourse(db)
+
+	added, err := course.AddCourse(nil, Snapshot{Status: FULL, MaxSeats: 40, Enrolled: 40, Waitlisted: 0}, "34270", "2016-92")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := course.DeferCourse(nil, added.ID, Snapshot{Status: OPEN, MaxSeats: 40, Enrolled: 30, Waitlisted: 0}, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// The seats that opened are only recorded together with the status, so the change is still seen then
+	deferred, err := course.GetCourseById(nil, added.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deferred.Snapshot() != added.Snapshot() {
+		t.Fatalf("DeferCourse changed the recorded snapshot to %+v; want %+v", deferred.Snapshot(), added.Snapshot())
+	}
+	if deferred.PendingStatus == nil || *deferred.PendingStatus != OPEN || deferred.PendingChecks != 1 {
+		t.Fatalf("DeferCourse recorded pending status %v for %v checks; want open for 1", deferred.PendingStatus, deferred.PendingChecks)
+	}
+}
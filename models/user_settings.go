@@ -0,0 +1,144 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// UserSettings are the notification settings of a user.
+type UserSettings struct {
+	// Locale is the locale the user receives notifications in, and is not valid if the user has not chosen one.
+	Locale sql.NullString `db:"locale"`
+	// UnsubscribedAt is when the user unsubscribed from all course alerts, and is nil while the user receives them.
+	UnsubscribedAt *time.Time `db:"unsubscribed_at"`
+	// Digest is true if the user receives one daily digest instead of an alert for every change.
+	Digest bool `db:"digest"`
+	// DigestSentAt is when the last digest was sent to the user.
+	DigestSentAt *time.Time `db:"digest_sent_at"`
+	// Verified is true if the user proved to receive mail at the current address.
+	Verified bool `db:"verified"`
+	// Undeliverable is true if mail to the current address of the user bounced.
+	Undeliverable bool `db:"undeliverable"`
+	// UndeliverableReason is why mail to the address bounced.
+	UndeliverableReason sql.NullString `db:"undeliverable_reason"`
+	// DeletionRequestedAt is when the user asked to delete the account, and is nil unless the deletion is pending.
+	DeletionRequestedAt *time.Time `db:"deletion_requested_at"`
+}
+
+// settingsColumns selects the columns of UserSettings.
+const settingsColumns = "locale, unsubscribed_at, digest, digest_sent_at, (verified_email IS NOT NULL AND verified_email = email) AS verified, " +
+	"(undeliverable_email IS NOT NULL AND undeliverable_email = email) AS undeliverable, undeliverable_reason, deletion_requested_at"
+
+// DigestRecipient is a user who receives daily digests.
+type DigestRecipient struct {
+	ID    int64  `db:"id"`
+	Email string `db:"email"`
+	UserSettings
+}
+
+// GetSettings returns the notification settings of the user.
+func (u *User) GetSettings(tx *sqlx.Tx, id int64) (*UserSettings, error) {
+	settings := &UserSettings{}
+	query := fmt.Sprintf("SELECT %v FROM %v WHERE id=$1", settingsColumns, u.table)
+	err := u.db.Get(settings, query, id)
+
+	return settings, err
+}
+
+// UpdateLocale sets the locale the user receives notifications in.
+func (u *User) UpdateLocale(tx *sqlx.Tx, id int64, locale string) error {
+	data := make(map[string]interface{})
+	data["locale"] = locale
+
+	_, err := u.UpdateByID(tx, data, id)
+	return err
+}
+
+// UpdateSubscription unsubscribes the user from all course alerts, or subscribes the user again.
+func (u *User) UpdateSubscription(tx *sqlx.Tx, id int64, subscribed bool) error {
+	data := make(map[string]interface{})
+	if subscribed {
+		data["unsubscribed_at"] = nil
+	} else {
+		data["unsubscribed_at"] = time.Now()
+	}
+
+	_, err := u.UpdateByID(tx, data, id)
+	return err
+}
+
+// UpdateDigest sets whether the user receives daily digests instead of an alert for every change.
+func (u *User) UpdateDigest(tx *sqlx.Tx, id int64, digest bool) error {
+	data := make(map[string]interface{})
+	data["digest"] = digest
+
+	_, err := u.UpdateByID(tx, data, id)
+	return err
+}
+
+// DigestRecipients returns the subscribed and verified users in digest mode, whose accounts are not being deleted, who were not sent a digest since the given time.
+func (u *User) DigestRecipients(tx *sqlx.Tx, sentBefore time.Time) ([]DigestRecipient, error) {
+	recipients := []DigestRecipient{}
+	query := fmt.Sprintf("SELECT id, email, %v FROM %v WHERE digest AND unsubscribed_at IS NULL AND verified_email = email AND undeliverable_email IS DISTINCT FROM email AND deletion_requested_at IS NULL AND (digest_sent_at IS NULL OR digest_sent_at < $1)", settingsColumns, u.table)
+	err := u.db.Select(&recipients, query, sentBefore)
+
+	return recipients, err
+}
+
+// MarkDigestSent records when a digest was sent to the user.
+func (u *User) MarkDigestSent(tx *sqlx.Tx, id int64, sentAt time.Time) error {
+	data := make(map[string]interface{})
+	data["digest_sent_at"] = sentAt
+
+	_, err := u.UpdateByID(tx, data, id)
+	return err
+}
+
+// VerifyEmail records that the user receives mail at the address.
+// It returns false if the address is no longer the user's, because the user changed it after the verification email was sent.
+func (u *User) VerifyEmail(tx *sqlx.Tx, id int64, email string) (bool, error) {
+	query := fmt.Sprintf("UPDATE %v SET verified_email=$2, email_verified_at=$3 WHERE id=$1 AND email=$2", u.table)
+	result, err := u.db.Exec(query, id, email, time.Now())
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+// MarkUndeliverable records that mail to the address bounced, which pauses the alerts of the users who use it until they change it.
+// It returns the number of users who use the address.
+func (u *User) MarkUndeliverable(tx *sqlx.Tx, email, reason string) (int64, error) {
+	query := fmt.Sprintf("UPDATE %v SET undeliverable_email=email, undeliverable_at=$2, undeliverable_reason=$3 WHERE lower(email)=lower($1)", u.table)
+	result, err := u.db.Exec(query, email, time.Now(), reason)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// ClearUndeliverable records that the user fixed the address, so that the user is notified again.
+func (u *User) ClearUndeliverable(tx *sqlx.Tx, id int64) error {
+	data := make(map[string]interface{})
+	data["undeliverable_email"] = nil
+	data["undeliverable_at"] = nil
+	data["undeliverable_reason"] = nil
+
+	_, err := u.UpdateByID(tx, data, id)
+	return err
+}
+
+// UnsubscribeByEmail unsubscribes the users of the address from all course alerts, and returns how many there were.
+func (u *User) UnsubscribeByEmail(tx *sqlx.Tx, email string) (int64, error) {
+	query := fmt.Sprintf("UPDATE %v SET unsubscribed_at=$2 WHERE lower(email)=lower($1) AND unsubscribed_at IS NULL", u.table)
+	result, err := u.db.Exec(query, email, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
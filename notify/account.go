@@ -0,0 +1,22 @@
+package notify
+
+// Names of account emails, which are rendered from templates/email/{name}.{subject,txt,html}.tmpl.
+const (
+	VerifyEmail   = "verify_email"
+	ResetPassword = "reset_password"
+)
+
+// accountData is what the templates of an account email are executed with.
+type accountData struct {
+	Locale string
+	URL    string
+}
+
+// RenderAccountEmail renders the named account email, which asks the user to follow the URL, in the locale.
+func RenderAccountEmail(name, locale, url string) (*Message, error) {
+	t, err := NewTranslator(locale)
+	if err != nil {
+		return nil, err
+	}
+	return render(name, t, accountData{Locale: t.Locale, URL: url})
+}
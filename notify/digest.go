@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"time"
+
+	"github.com/jpatrickpark/server1/links"
+	"github.com/jpatrickpark/server1/models"
+	"github.com/jpatrickpark/server1/websoc"
+)
+
+// Digest is the daily summary of every course a user watches.
+type Digest struct {
+	UserID  int64
+	Courses []models.CourseRow
+	// Changes are the recorded changes of the courses in the last day, oldest first.
+	Changes []models.StatusHistoryRow
+	// Location is the time zone the times of the changes are shown in.
+	Location *time.Location
+}
+
+// digestCourse is a course of a digest as shown by its templates.
+type digestCourse struct {
+	CourseCode string
+	Quarter    string
+	Status     string
+	Seats      string
+	Stale      bool
+	WebSocURL  string
+	Changes    []digestChange
+}
+
+type digestChange struct {
+	At     string
+	Status string
+	Seats  string
+}
+
+// digestData is what the templates of a digest are executed with.
+type digestData struct {
+	Locale         string
+	Headline       string
+	Courses        []digestCourse
+	UnsubscribeURL string
+}
+
+// RenderDigest renders the digest in the locale.
+func RenderDigest(locale string, digest Digest) (*Message, error) {
+	t, err := NewTranslator(locale)
+	if err != nil {
+		return nil, err
+	}
+	location := digest.Location
+	if location == nil {
+		location = time.Local
+	}
+
+	data := digestData{
+		Locale:         t.Locale,
+		Headline:       t.T("digest.headline", len(digest.Courses)),
+		UnsubscribeURL: links.Default.URL(links.Unsubscribe, digest.UserID, 0),
+	}
+	for _, course := range digest.Courses {
+		view := digestCourse{
+			CourseCode: course.CourseCode,
+			Quarter:    t.Quarter(course.Quarter),
+			Status:     t.T("status." + models.StatusCode(course.Status)),
+			Seats:      t.T("details.seats", seatCount(course.Enrolled), seatCount(course.MaxSeats), seatCount(course.Waitlisted)),
+			Stale:      course.Stale,
+			WebSocURL:  websoc.SectionURL(course.Quarter, course.CourseCode),
+		}
+		for _, change := range digest.Changes {
+			if change.CourseID != course.ID {
+				continue
+			}
+			view.Changes = append(view.Changes, digestChange{
+				At:     change.ChangedAt.In(location).Format("Jan 2 15:04"),
+				Status: t.T("status." + models.StatusCode(change.Status)),
+				Seats:  t.T("details.seats", seatCount(change.Enrolled), seatCount(change.MaxSeats), seatCount(change.Waitlisted)),
+			})
+		}
+		data.Courses = append(data.Courses, view)
+	}
+
+	message, err := render("digest", t, data)
+	if err != nil {
+		return nil, err
+	}
+	message.UnsubscribeURL = data.UnsubscribeURL
+	return message, nil
+}
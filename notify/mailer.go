@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+
+	"github.com/jpatrickpark/server1/metrics"
+)
+
+// Send delivers the message to the address through SendGrid, tagged with the category.
+// It returns an error if SendGrid could not be reached or did not accept the message.
+// Deliveries are counted by category in metrics.Notifications.
+func Send(email, category string, message *Message) error {
+	err := send(email, category, message)
+	if err != nil {
+		metrics.Notifications.WithLabelValues(category, "failed").Inc()
+	} else {
+		metrics.Notifications.WithLabelValues(category, "sent").Inc()
+	}
+	return err
+}
+
+func send(email, category string, message *Message) error {
+	from := mail.NewEmail("My UCI Class Is Full", "myuciclassisfull@gmail.com")
+	to := mail.NewEmail(email, email)
+	// SendGrid requires the plain-text alternative to come before the HTML one
+	mailMessage := mail.NewV3MailInit(from, message.Subject, to, mail.NewContent("text/plain", message.Text), mail.NewContent("text/html", message.HTML))
+	mailMessage.AddCategories(category)
+	if message.UnsubscribeURL != "" {
+		// RFC 8058 one-click unsubscribe: mail clients POST "List-Unsubscribe=One-Click" to the URL
+		mailMessage.SetHeader("List-Unsubscribe", "<"+message.UnsubscribeURL+">")
+		mailMessage.SetHeader("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+	}
+	request := sendgrid.GetRequest(os.Getenv("SENDGRID_API_KEY"), "/v3/mail/send", "https://api.sendgrid.com")
+	request.Method = "POST"
+	request.Body = mail.GetRequestBody(mailMessage)
+	response, err := sendgrid.API(request)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode >= 400 {
+		return fmt.Errorf("sendgrid answered %v: %v", response.StatusCode, response.Body)
+	}
+	return nil
+}
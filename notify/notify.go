@@ -0,0 +1,234 @@
+// Package notify renders the notification emails sent to users.
+//
+// The subject, plain-text body and HTML body of each message are rendered from the templates in
+// templates/email, and every sentence in them is looked up in the message catalog of the user's
+// locale in locales/{locale}.json.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	html_template "html/template"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	text_template "text/template"
+
+	"github.com/jpatrickpark/server1/links"
+	"github.com/jpatrickpark/server1/models"
+	"github.com/jpatrickpark/server1/rules"
+	"github.com/jpatrickpark/server1/websoc"
+)
+
+// DefaultLocale is used for users who have not chosen a locale and for messages missing from a catalog.
+const DefaultLocale = "en"
+
+// Locales are the locales that have a message catalog.
+var Locales = []string{"en", "ko", "es", "zh"}
+
+// LocaleNames are the names of the locales in their own languages.
+var LocaleNames = map[string]string{"en": "English", "ko": "한국어", "es": "Español", "zh": "中文"}
+
+// IsLocale reports whether the locale has a message catalog.
+func IsLocale(locale string) bool {
+	for _, l := range Locales {
+		if l == locale {
+			return true
+		}
+	}
+	return false
+}
+
+// UserLocale returns the locale of the user's settings, which is DefaultLocale until the user chooses one.
+func UserLocale(settings *models.UserSettings) string {
+	if settings == nil || !IsLocale(settings.Locale.String) {
+		return DefaultLocale
+	}
+	return settings.Locale.String
+}
+
+// Catalog maps message keys to fmt formats, which may use explicit argument indexes such as %[2]v
+// so that translations can reorder the arguments.
+type Catalog map[string]string
+
+// LoadCatalog reads the message catalog of the locale.
+func LoadCatalog(locale string) (Catalog, error) {
+	if !IsLocale(locale) {
+		return nil, fmt.Errorf("notify: unknown locale %q", locale)
+	}
+	content, err := ioutil.ReadFile("locales/" + locale + ".json")
+	if err != nil {
+		return nil, err
+	}
+	catalog := Catalog{}
+	if err := json.Unmarshal(content, &catalog); err != nil {
+		return nil, fmt.Errorf("notify: invalid catalog %v: %v", locale, err)
+	}
+	return catalog, nil
+}
+
+// Translator formats messages of a locale, falling back to DefaultLocale and then to the key itself.
+type Translator struct {
+	Locale   string
+	catalog  Catalog
+	fallback Catalog
+}
+
+// NewTranslator loads the catalogs of the locale and DefaultLocale.
+func NewTranslator(locale string) (*Translator, error) {
+	if !IsLocale(locale) {
+		locale = DefaultLocale
+	}
+	fallback, err := LoadCatalog(DefaultLocale)
+	if err != nil {
+		return nil, err
+	}
+	catalog := fallback
+	if locale != DefaultLocale {
+		if catalog, err = LoadCatalog(locale); err != nil {
+			return nil, err
+		}
+	}
+	return &Translator{Locale: locale, catalog: catalog, fallback: fallback}, nil
+}
+
+// T formats the message of the key with the given arguments.
+func (t *Translator) T(key string, args ...interface{}) string {
+	format, ok := t.catalog[key]
+	if !ok {
+		if format, ok = t.fallback[key]; !ok {
+			return key
+		}
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Quarter returns the name of the 7-digit quarter, such as 2017-03.
+func (t *Translator) Quarter(quarter string) string {
+	if len(quarter) != 7 {
+		return quarter
+	}
+	return t.T("quarter."+quarter[5:7], quarter[0:4])
+}
+
+// Alert is a change of a course a user is notified of.
+type Alert struct {
+	UserID     int64
+	CourseID   int64
+	CourseCode string
+	Quarter    string
+	Event      rules.Event
+	// Section is the WebSoc row of the course after the change, and nil when it is not known.
+	Section *websoc.Section
+}
+
+// headlineKey returns the catalog key of the sentence that describes the event.
+func (a Alert) headlineKey() string {
+	switch a.Event.Kind {
+	case rules.SeatsAvailable:
+		return "headline.seats"
+	case rules.WaitlistOpened:
+		return "headline.waitlist_opened"
+	case rules.ClosedAgain:
+		return "headline.closed"
+	default:
+		return "headline." + models.StatusCode(a.Event.Status)
+	}
+}
+
+// Message is a rendered notification.
+type Message struct {
+	Subject string
+	Text    string
+	HTML    string
+	// UnsubscribeURL unsubscribes the user from all course alerts with a POST, as the List-Unsubscribe header of RFC 8058.
+	UnsubscribeURL string
+}
+
+// alertData is what the templates of a course alert are executed with.
+type alertData struct {
+	Alert
+	Locale   string
+	Headline string
+	Closed   bool
+	// Seats describes the seat counts of Section.
+	Seats          string
+	WebSocURL      string
+	StopURL        string
+	SnoozeURL      string
+	UnsubscribeURL string
+}
+
+// RenderAlert renders the course alert in the locale.
+func RenderAlert(locale string, alert Alert) (*Message, error) {
+	t, err := NewTranslator(locale)
+	if err != nil {
+		return nil, err
+	}
+	data := alertData{
+		Alert:          alert,
+		Locale:         t.Locale,
+		Headline:       t.T(alert.headlineKey(), alert.CourseCode, t.Quarter(alert.Quarter), alert.Event.SeatsAvailable),
+		Closed:         alert.Event.Kind == rules.ClosedAgain,
+		WebSocURL:      websoc.SectionURL(alert.Quarter, alert.CourseCode),
+		StopURL:        links.Default.URL(links.StopWatching, alert.UserID, alert.CourseID),
+		SnoozeURL:      links.Default.URL(links.Snooze, alert.UserID, alert.CourseID),
+		UnsubscribeURL: links.Default.URL(links.Unsubscribe, alert.UserID, 0),
+	}
+	if section := alert.Section; section != nil {
+		data.Seats = t.T("details.seats", seatCount(section.Enrolled), seatCount(section.Max), seatCount(section.Waitlist))
+	}
+	message, err := render("course_alert", t, data)
+	if err != nil {
+		return nil, err
+	}
+	message.UnsubscribeURL = data.UnsubscribeURL
+	return message, nil
+}
+
+// seatCount shows seat counts that WebSoc shows as n/a as such.
+func seatCount(n int) string {
+	if n < 0 {
+		return "n/a"
+	}
+	return strconv.Itoa(n)
+}
+
+// render executes the subject, text and HTML templates of the named message.
+func render(name string, t *Translator, data interface{}) (*Message, error) {
+	funcs := map[string]interface{}{"t": t.T, "quarter": t.Quarter}
+	message := &Message{}
+
+	for _, part := range []struct {
+		file string
+		dest *string
+	}{
+		{name + ".subject.tmpl", &message.Subject},
+		{name + ".txt.tmpl", &message.Text},
+	} {
+		tmpl, err := text_template.New(part.file).Funcs(funcs).ParseFiles("templates/email/" + part.file)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		*part.dest = buf.String()
+	}
+	message.Subject = strings.TrimSpace(message.Subject)
+
+	file := name + ".html.tmpl"
+	tmpl, err := html_template.New(file).Funcs(funcs).ParseFiles("templates/email/" + file)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	message.HTML = buf.String()
+
+	return message, nil
+}
@@ -0,0 +1,66 @@
+package notify
+
+import (
+	"os"
+	"testing"
+
+	"github.com/jpatrickpark/server1/models"
+	"github.com/jpatrickpark/server1/rules"
+)
+
+// inRepoRoot changes into the root of the repository, where the catalogs and templates are read from.
+func inRepoRoot(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(".."); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestCatalogsHaveHeadlinesOfEveryRuleStatus(t *testing.T) {
+	inRepoRoot(t)
+
+	// A rule may name any course status, and its alert headline must not be the raw key
+	for _, locale := range Locales {
+		catalog, err := LoadCatalog(locale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for status := models.FULL; status <= models.UNKNOWN; status++ {
+			if !rules.IsCourseStatus(status) {
+				continue
+			}
+			if key := "headline." + models.StatusCode(status); catalog[key] == "" {
+				t.Errorf("%v: %v is missing", locale, key)
+			}
+		}
+	}
+}
+
+func TestCatalogsHaveEveryKey(t *testing.T) {
+	inRepoRoot(t)
+
+	english, err := LoadCatalog("en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, locale := range Locales {
+		catalog, err := LoadCatalog(locale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for key := range english {
+			if catalog[key] == "" {
+				t.Errorf("%v: %v is missing", locale, key)
+			}
+		}
+		for key := range catalog {
+			if _, ok := english[key]; !ok {
+				t.Errorf("%v: %v is not in the English catalog", locale, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package application
+
+import (
+	"github.com/jmoiron/sqlx"
+	"log/slog"
+	"time"
+
+	"github.com/jpatrickpark/server1/handlers"
+	"github.com/jpatrickpark/server1/middlewares"
+	"github.com/jpatrickpark/server1/models"
+)
+
+const (
+	// retentionInterval is how often past quarters are collected.
+	retentionInterval = 24 * time.Hour
+	// retentionGrace is how long a quarter is kept after it closes for the students.
+	retentionGrace = 30 * 24 * time.Hour
+	// unwatchedGrace is how long a course nobody watches is kept before it is deleted.
+	unwatchedGrace = 7 * 24 * time.Hour
+)
+
+// CollectPastQuarters deletes the courses of closed quarters together with their user-course pairs once a day.
+// It also deletes the courses nobody has watched for unwatchedGrace, the expired sessions
+// and the accounts whose users asked to delete them models.AccountDeletionGrace ago.
+// When dryRun is true, it only logs what would have been deleted.
+func CollectPastQuarters(db *sqlx.DB, dryRun bool) {
+	for {
+		course := models.NewCourse(db)
+		now := time.Now()
+		logger := slog.Default().With("job", "retention", "run_id", middlewares.NewCorrelationID(), "dry_run", dryRun)
+		collectPastQuarters(course, now, dryRun, logger)
+		collectUnwatchedCourses(course, now, dryRun, logger)
+		collectExpiredSessions(models.NewSession(db), now, dryRun, logger)
+		collectDeletedAccounts(models.NewUser(db), now, dryRun, logger)
+		time.Sleep(retentionInterval)
+	}
+}
+
+func collectPastQuarters(course *models.Course, now time.Time, dryRun bool, logger *slog.Logger) {
+	before := handlers.OldestPossibleQuarter(now.Add(-retentionGrace))
+	if before == "" {
+		return
+	}
+
+	if dryRun {
+		courses, pairs, err := course.CountCoursesBeforeQuarter(nil, before)
+		if err != nil {
+			logger.Error("retention: failed to count courses", "before", before, "err", err)
+			return
+		}
+		logger.Info("retention: dry run, would delete courses", "courses", courses, "pairs", pairs, "before", before)
+		return
+	}
+
+	courses, pairs, err := course.DeleteCoursesBeforeQuarter(nil, before)
+	if err != nil {
+		logger.Error("retention: failed to delete courses", "before", before, "err", err)
+		return
+	}
+	logger.Info("retention: deleted courses", "courses", courses, "pairs", pairs, "before", before)
+}
+
+func collectUnwatchedCourses(course *models.Course, now time.Time, dryRun bool, logger *slog.Logger) {
+	// Courses that lost their watchers before unwatched_at existed are marked here, starting their grace period
+	if !dryRun {
+		marked, err := course.MarkUnwatchedCourses(nil)
+		if err != nil {
+			logger.Error("retention: failed to mark unwatched courses", "err", err)
+			return
+		}
+		if marked > 0 {
+			logger.Info("retention: marked courses as unwatched", "courses", marked)
+		}
+	}
+
+	before := now.Add(-unwatchedGrace)
+	if dryRun {
+		courses, err := course.CountUnwatchedCourses(nil, before)
+		if err != nil {
+			logger.Error("retention: failed to count unwatched courses", "err", err)
+			return
+		}
+		logger.Info("retention: dry run, would delete unwatched courses", "courses", courses, "unwatched_before", before)
+		return
+	}
+
+	courses, err := course.DeleteUnwatchedCourses(nil, before)
+	if err != nil {
+		logger.Error("retention: failed to delete unwatched courses", "err", err)
+		return
+	}
+	logger.Info("retention: deleted unwatched courses", "courses", courses, "unwatched_before", before)
+}
+
+func collectExpiredSessions(session *models.Session, now time.Time, dryRun bool, logger *slog.Logger) {
+	// Expired sessions are never loaded again, so a dry run has nothing to report about them
+	if dryRun {
+		return
+	}
+
+	sessions, err := session.DeleteExpiredSessions(nil, now)
+	if err != nil {
+		logger.Error("retention: failed to delete expired sessions", "err", err)
+		return
+	}
+	logger.Info("retention: deleted expired sessions", "sessions", sessions)
+}
+
+func collectDeletedAccounts(user *models.User, now time.Time, dryRun bool, logger *slog.Logger) {
+	before := now.Add(-models.AccountDeletionGrace)
+	if dryRun {
+		users, err := user.CountScheduledAccounts(nil, before)
+		if err != nil {
+			logger.Error("retention: failed to count accounts to delete", "err", err)
+			return
+		}
+		logger.Info("retention: dry run, would delete accounts", "accounts", users, "requested_before", before)
+		return
+	}
+
+	users, err := user.DeleteScheduledAccounts(nil, before)
+	if err != nil {
+		logger.Error("retention: failed to delete accounts", "err", err)
+		return
+	}
+	logger.Info("retention: deleted accounts", "accounts", users, "requested_before", before)
+}
@@ -0,0 +1,98 @@
+// Package rules decides which users are notified of a change of a course.
+//
+// The poller calls Evaluate with the snapshots of a course before and after a check for the
+// rule of every watch of the course, and notifies the user of each returned event.
+package rules
+
+import (
+	"github.com/jpatrickpark/server1/models"
+)
+
+// Kinds of events.
+const (
+	// StatusChanged means the course entered one of the statuses of the rule.
+	StatusChanged = "status"
+	// SeatsAvailable means at least MinSeats seats became available.
+	SeatsAvailable = "seats"
+	// WaitlistOpened means a waitlist position became available.
+	WaitlistOpened = "waitlist"
+	// ClosedAgain means an available course became full again.
+	ClosedAgain = "closed"
+)
+
+// DefaultStatuses are the statuses users are notified of when their rule does not list any.
+var DefaultStatuses = []int{models.OPEN, models.WAITLIST, models.NEWONLY_WAITLIST}
+
+// Event is a change of a course that a user asked to be notified of.
+type Event struct {
+	Kind           string
+	Status         int
+	SeatsAvailable int
+}
+
+// Evaluate returns the events that the change from old to new triggers for the rule, most important first.
+// It returns nothing for snapshots that are not real statuses such as UNKNOWN.
+func Evaluate(rule models.WatchRule, old, new models.Snapshot) []Event {
+	if !IsCourseStatus(old.Status) || !IsCourseStatus(new.Status) {
+		return nil
+	}
+
+	var events []Event
+	event := func(kind string) {
+		events = append(events, Event{kind, new.Status, new.SeatsAvailable()})
+	}
+
+	// With the default statuses, an open course becoming waitlisted is not news
+	downgrade := len(rule.Statuses) == 0 && old.Status == models.OPEN
+	if new.Status != old.Status && contains(statuses(rule), new.Status) && !downgrade {
+		event(StatusChanged)
+	}
+	if rule.MinSeats > 0 && old.SeatsAvailable() < rule.MinSeats && new.SeatsAvailable() >= rule.MinSeats {
+		event(SeatsAvailable)
+	}
+	if rule.Waitlist && !isWaitlist(old.Status) && isWaitlist(new.Status) {
+		event(WaitlistOpened)
+	}
+	if rule.Closed && isAvailable(old.Status) && (new.Status == models.FULL || new.Status == models.NEWONLY_FULL) {
+		event(ClosedAgain)
+	}
+	return events
+}
+
+func statuses(rule models.WatchRule) []int {
+	if len(rule.Statuses) == 0 {
+		return DefaultStatuses
+	}
+	statuses := make([]int, len(rule.Statuses))
+	for i, status := range rule.Statuses {
+		statuses[i] = int(status)
+	}
+	return statuses
+}
+
+func contains(statuses []int, status int) bool {
+	for _, item := range statuses {
+		if item == status {
+			return true
+		}
+	}
+	return false
+}
+
+// IsCourseStatus reports whether the status describes a course rather than the outcome of a request.
+func IsCourseStatus(status int) bool {
+	switch status {
+	case models.FULL, models.OPEN, models.WAITLIST, models.NONEXISTENT, models.NEWONLY_FULL, models.NEWONLY_WAITLIST:
+		return true
+	default:
+		return false
+	}
+}
+
+func isWaitlist(status int) bool {
+	return status == models.WAITLIST || status == models.NEWONLY_WAITLIST
+}
+
+func isAvailable(status int) bool {
+	return status == models.OPEN || isWaitlist(status)
+}
@@ -0,0 +1,158 @@
+// Package sessionstore provides a gorilla/sessions store that keeps sessions in Postgres,
+// so that they can be revoked on the server.
+package sessionstore
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/gob"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/jpatrickpark/server1/models"
+)
+
+// Store keeps the values of sessions in the sessions table, gob encoded like sessions.CookieStore does,
+// with only the ID of the signed in user. The cookie only carries the signed ID of the session.
+type Store struct {
+	db      *sqlx.DB
+	Codecs  []securecookie.Codec
+	Options *sessions.Options
+}
+
+// New returns a store that signs session IDs with the key pairs, as sessions.NewCookieStore does.
+func New(db *sqlx.DB, keyPairs ...[]byte) *Store {
+	return &Store{
+		db:     db,
+		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{
+			Path:   "/",
+			MaxAge: 86400 * 30,
+		},
+	}
+}
+
+// Get returns the session of the name cached for the request, loading it the first time.
+func (s *Store) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session of the name from the database.
+// It returns a new session when the cookie is missing or invalid, or the session expired or was revoked.
+func (s *Store) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	options := *s.Options
+	session.Options = &options
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	if err = securecookie.DecodeMulti(name, cookie.Value, &session.ID, s.Codecs...); err != nil {
+		session.ID = ""
+		return session, err
+	}
+
+	row, err := models.NewSession(s.db).GetValidSession(nil, session.ID)
+	if err == sql.ErrNoRows {
+		session.ID = ""
+		return session, nil
+	}
+	if err != nil {
+		return session, err
+	}
+	if err = gob.NewDecoder(bytes.NewReader(row.Data)).Decode(&session.Values); err != nil {
+		return session, err
+	}
+	session.IsNew = false
+
+	return session, nil
+}
+
+// Save stores the session and sets its cookie, or deletes both when Options.MaxAge is negative.
+func (s *Store) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	sessionModel := models.NewSession(s.db)
+
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := sessionModel.DeleteSession(nil, session.ID); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	var userId int64
+	if user, ok := session.Values["user"].(*models.UserRow); ok {
+		userId = user.ID
+	}
+
+	// A session that someone signed in to gets a new ID, so that an ID planted before the sign in is worthless
+	if session.ID != "" && userId != 0 {
+		row, err := sessionModel.GetValidSession(nil, session.ID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == sql.ErrNoRows || row.UserID.Int64 != userId {
+			if err := s.Renew(session); err != nil {
+				return err
+			}
+		}
+	}
+
+	if session.ID == "" {
+		random := make([]byte, 32)
+		if _, err := rand.Read(random); err != nil {
+			return err
+		}
+		session.ID = base64.RawURLEncoding.EncodeToString(random)
+	}
+
+	// Only the ID of the user is stored, as SetCurrentUser loads the rest of the row for every request
+	values := make(map[interface{}]interface{}, len(session.Values))
+	for key, value := range session.Values {
+		values[key] = value
+	}
+	if userId != 0 {
+		values["user"] = &models.UserRow{ID: userId}
+	}
+
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(values); err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(time.Duration(session.Options.MaxAge) * time.Second)
+	if err := sessionModel.SaveSession(nil, session.ID, userId, data.Bytes(), expiresAt); err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// Renew deletes the stored session, so that it is saved under a new ID.
+// The CSRF token is dropped as well, since whoever knew the old ID may know it.
+func (s *Store) Renew(session *sessions.Session) error {
+	delete(session.Values, "csrfToken")
+	if session.ID == "" {
+		return nil
+	}
+	if err := models.NewSession(s.db).DeleteSession(nil, session.ID); err != nil {
+		return err
+	}
+	session.ID = ""
+	return nil
+}
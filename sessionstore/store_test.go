@@ -0,0 +1,90 @@
+package sessionstore
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/gob"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jpatrickpark/server1/models"
+	"github.com/jpatrickpark/server1/testdb"
+)
+
+// The app registers the user type in main, as sessions.CookieStore needs it too.
+func init() {
+	gob.Register(&models.UserRow{})
+}
+
+func TestSignInRenewsSession(t *testing.T) {
+	db := testdb.New(t, testdb.Users, testdb.Sessions)
+	store := New(db, []byte("0123456789abcdef0123456789abcdef"))
+	var userId int64
+	if err := db.Get(&userId, "INSERT INTO users (email) VALUES ('student@uci.edu') RETURNING id"); err != nil {
+		t.Fatal(err)
+	}
+
+	// An anonymous session, such as one whose ID was planted in the browser
+	session, err := store.New(httptest.NewRequest("GET", "/login", nil), "server1-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Values["csrfToken"] = "planted"
+	if err := store.Save(httptest.NewRequest("GET", "/login", nil), httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+	planted := session.ID
+
+	session.Values["user"] = &models.UserRow{ID: userId}
+	if err := store.Save(httptest.NewRequest("POST", "/login", nil), httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+	if session.ID == planted {
+		t.Fatal("signing in kept the session ID")
+	}
+	if _, ok := session.Values["csrfToken"]; ok {
+		t.Fatal("signing in kept the CSRF token")
+	}
+	if _, err := models.NewSession(db).GetValidSession(nil, planted); err != sql.ErrNoRows {
+		t.Fatalf("GetValidSession of the planted ID = %v; want sql.ErrNoRows", err)
+	}
+
+	// Saving the signed in session again keeps its ID
+	renewed := session.ID
+	if err := store.Save(httptest.NewRequest("GET", "/", nil), httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+	if session.ID != renewed {
+		t.Fatal("saving a signed in session changed its ID")
+	}
+}
+
+func TestSaveStoresOnlyTheUserID(t *testing.T) {
+	db := testdb.New(t, testdb.Users, testdb.Sessions)
+	store := New(db, []byte("0123456789abcdef0123456789abcdef"))
+	var userId int64
+	if err := db.Get(&userId, "INSERT INTO users (email) VALUES ('student@uci.edu') RETURNING id"); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := store.New(httptest.NewRequest("POST", "/login", nil), "server1-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Values["user"] = &models.UserRow{ID: userId, Email: "student@uci.edu", Password: "hash"}
+	if err := store.Save(httptest.NewRequest("POST", "/login", nil), httptest.NewRecorder(), session); err != nil {
+		t.Fatal(err)
+	}
+
+	row, err := models.NewSession(db).GetValidSession(nil, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[interface{}]interface{}{}
+	if err := gob.NewDecoder(bytes.NewReader(row.Data)).Decode(&values); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := values["user"].(*models.UserRow); user == nil || *user != (models.UserRow{ID: userId}) {
+		t.Fatalf("stored user = %+v; want only the ID %v", values["user"], userId)
+	}
+}
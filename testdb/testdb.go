@@ -0,0 +1,127 @@
+// Package testdb gives tests a Postgres schema of their own with the tables of the README.
+//
+// Tests that need a database are skipped unless TEST_DATABASE_URL is set, for example to
+// postgres://localhost/myuci_test?sslmode=disable.
+package testdb
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// Tables of the README, to be passed to New.
+const (
+	Users = `CREATE TABLE users (
+		id BIGSERIAL PRIMARY KEY,
+		email TEXT UNIQUE,
+		password TEXT,
+		locale TEXT,
+		unsubscribed_at TIMESTAMP,
+		digest BOOLEAN NOT NULL DEFAULT FALSE,
+		digest_sent_at TIMESTAMP,
+		verified_email TEXT,
+		email_verified_at TIMESTAMP,
+		undeliverable_email TEXT,
+		undeliverable_at TIMESTAMP,
+		undeliverable_reason TEXT,
+		deletion_requested_at TIMESTAMP
+	)`
+	Courses = `CREATE TABLE courses (
+		id BIGSERIAL PRIMARY KEY,
+		coursecode TEXT,
+		status INT,
+		quarter TEXT,
+		last_checked_at TIMESTAMP,
+		last_changed_at TIMESTAMP,
+		unwatched_at TIMESTAMP,
+		max_seats INT NOT NULL DEFAULT -1,
+		enrolled INT NOT NULL DEFAULT -1,
+		waitlisted INT NOT NULL DEFAULT -1,
+		pending_status INT,
+		pending_checks INT NOT NULL DEFAULT 0
+	)`
+	UserCoursePairs = `CREATE TABLE user_course_pair (
+		id BIGSERIAL PRIMARY KEY,
+		course_id BIGSERIAL,
+		user_id BIGSERIAL,
+		notify_statuses INT[] NOT NULL DEFAULT '{}',
+		min_seats INT NOT NULL DEFAULT 0,
+		notify_waitlist BOOLEAN NOT NULL DEFAULT FALSE,
+		notify_closed BOOLEAN NOT NULL DEFAULT FALSE,
+		snoozed_until TIMESTAMP
+	)`
+	CourseStatusHistory = `CREATE TABLE course_status_history (
+		id BIGSERIAL PRIMARY KEY,
+		course_id BIGINT REFERENCES courses ON DELETE CASCADE,
+		status INT,
+		max_seats INT,
+		enrolled INT,
+		waitlisted INT,
+		changed_at TIMESTAMP
+	)`
+	Sessions = `CREATE TABLE sessions (
+		id TEXT PRIMARY KEY,
+		user_id BIGINT REFERENCES users ON DELETE CASCADE,
+		data BYTEA,
+		created_at TIMESTAMP,
+		updated_at TIMESTAMP,
+		expires_at TIMESTAMP
+	)`
+)
+
+// New returns a connection to a new schema of the database at TEST_DATABASE_URL in which the statements were run.
+// The schema is dropped when the test ends. The test is skipped when TEST_DATABASE_URL is not set.
+func New(t *testing.T, statements ...string) *sqlx.DB {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("test_%v", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		admin.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		admin.Close()
+	})
+
+	// Every connection of the pool has to use the schema
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		query := u.Query()
+		query.Set("search_path", schema)
+		u.RawQuery = query.Encode()
+		dsn = u.String()
+	} else {
+		dsn += " search_path=" + schema
+	}
+
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
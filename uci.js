@@ -1,15 +1,8 @@
 // js code included in templates/uci.html.tmpl, in a separate file for readability
 $( function() {
     AJAX_ERROR = -1;
-    FULL = 0;
-    OPEN = 1;
-    WAITLIST = 2;
-    NONEXISTENT = 3;
-    DELETED = 4;
-    ENTRYEXISTS = 5;
-    NOTDELETED = 6;
-	NEWONLY_FULL     = 7;
-	NEWONLY_WAITLIST = 8;
+    // PUT and DELETE requests get the CSRF token header from the prefilter in templates/dashboard.html.tmpl.
+    // Status constants such as FULL and OPEN are generated into templates/status.js.tmpl by cmd/genstatus.
 
 
     function createServerResponseElement(stat,code) {
@@ -57,6 +50,14 @@ $( function() {
             icon = '<i class="fa fa-exclamation-triangle fa-5x" style="color: blue;"></i>';
             message = '<h4>Course '+code+' has an open waitlist for current students!</h4><h4> You can go ahead and enroll if your window is open.</h4><h4>You will still get notified in case you cannot enroll before it gets full.</h4>';
             break;
+        case INVALID:
+            icon = '<i class="fa fa-ban fa-5x" style="color: red;"></i>';
+            message = '<h4>'+code+' is not a valid 5-digit course code for this quarter!</h4>';
+            break;
+        case UNKNOWN:
+            icon = '<i class="fa fa-ban fa-5x" style="color: red;"></i>';
+            message = '<h4>We could not reach WebSOC to check course '+code+'.</h4><h4>Please try again in a few minutes.</h4>';
+            break;
         default:
             break;
         }
@@ -95,6 +96,9 @@ $( function() {
                     subelement = subelement.concat("</td><td>error");
                     break;
                 }
+                if (value.stale) {
+                    subelement = subelement.concat(" <i class='fa fa-clock-o' title='Not checked recently, this status may be out of date.'></i>");
+                }
                 subelement = subelement.concat("</td>");
                 subelement = subelement.concat("<td><a class='deleteButton' url='/my-uci-class-is-full/term/");
                 subelement = subelement.concat(value.quarter + "/" + value.courseCode);
@@ -117,6 +121,15 @@ $( function() {
     $displayResponse = $('#status');
     $table = $('#table');
 
+    function displayTermResponse(result, code) {
+        // Displays a PUT or DELETE response, which carries the user's course list whatever its HTTP status is.
+        $displayResponse.append(createServerResponseElement(result.status, code));
+        if (result.courses) {
+            $('#tableBody').remove();
+            $table.append(createCourseListElement(result.courses));
+            addListenerToDeleteButtons();
+        }
+    };
     // When user submits request, put it to the user's request set for the according term.
     $courseCodeForm.submit(function(event) {
         event.preventDefault();
@@ -126,16 +139,17 @@ $( function() {
             type: 'PUT',
             data: {courseCode: $courseCode.val()},
             success: function (result) {
-              $displayResponse.append(createServerResponseElement(result.status, $courseCode.val()));
-              if (result.status != NONEXISTENT) {
-                $('#tableBody').remove();
-                $table.append(createCourseListElement(result.courses));
-                addListenerToDeleteButtons();
-              }
+              displayTermResponse(result, $courseCode.val());
               $courseCode.val('');
             },
             error: function (textStatus, errThrown) {
-              $displayResponse.append(createServerResponseElement(-1, textStatus));
+              // 404, 409 and 422 responses describe the outcome in the same JSON as successful ones
+              if (textStatus.responseJSON && textStatus.responseJSON.code) {
+                displayTermResponse(textStatus.responseJSON, $courseCode.val());
+                $courseCode.val('');
+                return;
+              }
+              $displayResponse.append(createServerResponseElement(AJAX_ERROR, textStatus.statusText));
             }
         });
     });
@@ -149,13 +163,15 @@ $( function() {
             url: url,
             type: 'DELETE',
             success: function (result) {
-              $displayResponse.append(createServerResponseElement(result.status, url.substr(url.length-5)));
-              $('#tableBody').remove();
-              $table.append(createCourseListElement(result.courses));
-              addListenerToDeleteButtons();
+              displayTermResponse(result, url.substr(url.length-5));
               $courseCode.val('');
             },
             error: function (textStatus, errThrown) {
+                // 404 means the course was not one of the user's courses
+                if (textStatus.responseJSON && textStatus.responseJSON.code) {
+                  displayTermResponse(textStatus.responseJSON, url.substr(url.length-5));
+                  return;
+                }
                 $.each(textStatus, function(key,value) {
                   if (key=='responseText') {
                     alert(value);
@@ -165,18 +181,98 @@ $( function() {
         });
     });
     };
+    // When user picks another language, notifications are sent in it from then on.
+    $('#locale').change(function() {
+        $('#serverResponse').remove();
+        $.ajax({
+            url: $('#localeForm').attr('action'),
+            type: 'PUT',
+            data: {locale: $(this).val()},
+            error: function (textStatus, errThrown) {
+              $displayResponse.append(createServerResponseElement(AJAX_ERROR, textStatus.statusText));
+            }
+        });
+    });
+    // When user picks how to be emailed, course alerts or daily digests are sent from then on.
+    $('#digest').change(function() {
+        $('#serverResponse').remove();
+        $.ajax({
+            url: '/my-uci-class-is-full/digest',
+            type: 'PUT',
+            data: {digest: $(this).val()},
+            error: function (textStatus, errThrown) {
+              $displayResponse.append(createServerResponseElement(AJAX_ERROR, textStatus.statusText));
+            }
+        });
+    });
+    // When an unverified user asks for another verification email, it is sent to the current address.
+    $('#resendVerificationButton').click(function() {
+        $.ajax({
+            url: '/my-uci-class-is-full/verification',
+            type: 'POST',
+            success: function (result) {
+              $('#resendVerificationButton').prop('disabled', true).text('Sent');
+            },
+            error: function (textStatus, errThrown) {
+              $displayResponse.append(createServerResponseElement(AJAX_ERROR, textStatus.statusText));
+            }
+        });
+    });
+    // When an unsubscribed user resumes emails, course alerts are sent again.
+    $('#resumeButton').click(function() {
+        $.ajax({
+            url: '/my-uci-class-is-full/subscription',
+            type: 'PUT',
+            data: {subscribed: 'true'},
+            success: function (result) {
+              $('#unsubscribedNotice').remove();
+            },
+            error: function (textStatus, errThrown) {
+              $displayResponse.append(createServerResponseElement(AJAX_ERROR, textStatus.statusText));
+            }
+        });
+    });
+    // When user asks to delete the account, it is deleted after a grace period unless the user keeps it.
+    $('#deleteAccountButton').click(function() {
+        var password = prompt('Your account, your courses and your notification history will be deleted in 14 days. Enter your password to delete your account.');
+        if (!password) {
+            return;
+        }
+        $.ajax({
+            url: '/my-uci-class-is-full/account/deletion',
+            type: 'POST',
+            data: {Password: password},
+            success: function (result) {
+              location.reload();
+            },
+            error: function (textStatus, errThrown) {
+              $displayResponse.append(createServerResponseElement(AJAX_ERROR, textStatus.statusText));
+            }
+        });
+    });
+    $('#keepAccountButton').click(function() {
+        $.ajax({
+            url: '/my-uci-class-is-full/account/deletion',
+            type: 'DELETE',
+            success: function (result) {
+              location.reload();
+            },
+            error: function (textStatus, errThrown) {
+              $displayResponse.append(createServerResponseElement(AJAX_ERROR, textStatus.statusText));
+            }
+        });
+    });
     // GET USER COURSE LIST AS A TABLE
     $.ajax({
-        url: $courseCodeForm.attr('action'),
-        type: 'PUT',
-        data: {courseCode: 'init'},
+        url: $courseCodeForm.attr('action') + '/courses',
+        type: 'GET',
         success: function (result) {
             $('#tableBody').remove();
             $table.append(createCourseListElement(result.courses));
             addListenerToDeleteButtons();
         },
         error: function (textStatus, errThrown) {
-            $displayResponse.append(createServerResponseElement(-1, textStatus));
+            $displayResponse.append(createServerResponseElement(AJAX_ERROR, textStatus.statusText));
         }
     });
 });
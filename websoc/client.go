@@ -0,0 +1,287 @@
+// Package websoc provides the HTTP client used to query WebSoc, the schedule of classes of UCI.
+//
+// All requests to reg.uci.edu go through a single Client, so that a slow or failing WebSoc is
+// not hammered by one request per course: requests time out, failed requests are retried with
+// exponential backoff and jitter, Retry-After is honored, and a circuit breaker stops sending
+// requests for a while after repeated failures.
+package websoc
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jpatrickpark/server1/metrics"
+)
+
+const (
+	// DefaultUserAgent identifies the app to reg.uci.edu unless another User-Agent is configured.
+	DefaultUserAgent = "MyUCIClassIsFull/1.0 (+https://apps.jpatrickpark.com/my-uci-class-is-full)"
+
+	requestTimeout   = 10 * time.Second
+	maxRetries       = 2
+	baseBackoff      = 500 * time.Millisecond
+	maxBackoff       = 5 * time.Second
+	failureThreshold = 5
+	minOpenDuration  = 30 * time.Second
+	maxOpenDuration  = 10 * time.Minute
+)
+
+// ErrCircuitOpen is returned without sending a request while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("websoc: circuit breaker is open")
+
+// Circuit breaker states.
+const (
+	Closed   = "closed"
+	Open     = "open"
+	HalfOpen = "half-open"
+)
+
+// Default is the client shared by every WebSoc lookup.
+var Default = NewClient(DefaultUserAgent)
+
+// Status is a snapshot of the state of a Client.
+type Status struct {
+	State               string
+	UserAgent           string
+	ConsecutiveFailures int
+	OpenUntil           time.Time
+	LastError           string
+	LastErrorAt         time.Time
+	Requests            int64
+	Failures            int64
+}
+
+// Client sends GET requests to WebSoc. It is safe for concurrent use.
+type Client struct {
+	httpClient *http.Client
+
+	mu           sync.Mutex
+	userAgent    string
+	state        string
+	failures     int
+	openDuration time.Duration
+	openUntil    time.Time
+	trialRunning bool
+	lastError    string
+	lastErrorAt  time.Time
+	requests     int64
+	failed       int64
+}
+
+// NewClient returns a Client that identifies itself with the given User-Agent.
+func NewClient(userAgent string) *Client {
+	return &Client{
+		httpClient:   &http.Client{Timeout: requestTimeout},
+		userAgent:    userAgent,
+		state:        Closed,
+		openDuration: minOpenDuration,
+	}
+}
+
+// SetUserAgent changes the User-Agent sent with every request.
+func (c *Client) SetUserAgent(userAgent string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.userAgent = userAgent
+}
+
+// Status returns a snapshot of the circuit breaker and the request counters.
+func (c *Client) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Status{
+		State:               c.state,
+		UserAgent:           c.userAgent,
+		ConsecutiveFailures: c.failures,
+		OpenUntil:           c.openUntil,
+		LastError:           c.lastError,
+		LastErrorAt:         c.lastErrorAt,
+		Requests:            c.requests,
+		Failures:            c.failed,
+	}
+}
+
+// Get fetches the given URL and returns the body of a 200 response.
+// Network errors, 429 and 5xx responses are retried before they count as a failure of WebSoc.
+// Other errors, such as a 404 for an unknown course code, do not count toward the circuit breaker.
+func (c *Client) Get(url string) ([]byte, error) {
+	if err := c.allow(); err != nil {
+		metrics.WebSocErrors.WithLabelValues("circuit_open").Inc()
+		return nil, err
+	}
+
+	var body []byte
+	var err error
+	var retry bool
+	for attempt := 0; ; attempt++ {
+		var retryAfter time.Duration
+		body, retryAfter, retry, err = c.get(url)
+		if err == nil || !retry || attempt == maxRetries {
+			break
+		}
+
+		wait := backoff(attempt)
+		if retryAfter > maxBackoff {
+			// WebSoc asked for a longer pause than a retry is worth; open the breaker for that long
+			c.failure(err, retryAfter)
+			return nil, err
+		}
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		time.Sleep(wait)
+	}
+
+	if err != nil && !retry {
+		c.release()
+		return nil, err
+	}
+	if err != nil {
+		c.failure(err, 0)
+		return nil, err
+	}
+	c.success()
+	return body, nil
+}
+
+// get sends a single request. retry reports whether the error is worth retrying.
+func (c *Client) get(url string) ([]byte, time.Duration, bool, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	c.mu.Lock()
+	req.Header.Set("User-Agent", c.userAgent)
+	c.requests++
+	c.mu.Unlock()
+
+	// Failed requests are timed too, so that timeouts show in the histogram
+	started := time.Now()
+	defer func() { metrics.WebSocRequestDuration.Observe(time.Since(started).Seconds()) }()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		metrics.WebSocErrors.WithLabelValues("network").Inc()
+		return nil, 0, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		metrics.WebSocErrors.WithLabelValues("status").Inc()
+		return nil, parseRetryAfter(resp.Header.Get("Retry-After")), true, fmt.Errorf("websoc: %v", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		metrics.WebSocErrors.WithLabelValues("status").Inc()
+		return nil, 0, false, fmt.Errorf("websoc: %v", resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		metrics.WebSocErrors.WithLabelValues("read").Inc()
+		return nil, 0, true, err
+	}
+	return body, 0, false, nil
+}
+
+// allow decides whether a request may be sent in the current state of the breaker.
+func (c *Client) allow() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch c.state {
+	case Open:
+		if time.Now().Before(c.openUntil) {
+			return ErrCircuitOpen
+		}
+		c.state = HalfOpen
+		c.trialRunning = true
+		return nil
+	case HalfOpen:
+		// Only one trial request at a time while WebSoc is recovering
+		if c.trialRunning {
+			return ErrCircuitOpen
+		}
+		c.trialRunning = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+func (c *Client) success() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state = Closed
+	c.failures = 0
+	c.openDuration = minOpenDuration
+	c.trialRunning = false
+}
+
+// release ends a request that says nothing about the health of WebSoc, letting the next trial through if the breaker is half-open.
+func (c *Client) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.trialRunning = false
+}
+
+// failure records a failed request and opens the breaker when needed, for at least openAtLeast.
+func (c *Client) failure(err error, openAtLeast time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.failures++
+	c.failed++
+	c.lastError = err.Error()
+	c.lastErrorAt = time.Now()
+	c.trialRunning = false
+
+	switch {
+	case c.state == HalfOpen:
+		// The trial failed, so wait twice as long before the next one
+		c.openDuration *= 2
+		if c.openDuration > maxOpenDuration {
+			c.openDuration = maxOpenDuration
+		}
+	case c.failures < failureThreshold && openAtLeast == 0:
+		return
+	}
+
+	duration := c.openDuration
+	if openAtLeast > duration {
+		duration = openAtLeast
+	}
+	c.state = Open
+	c.openUntil = time.Now().Add(duration)
+}
+
+// backoff returns the wait before the given retry: exponential with full jitter.
+func backoff(attempt int) time.Duration {
+	ceiling := baseBackoff << uint(attempt)
+	if ceiling > maxBackoff {
+		ceiling = maxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)))
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
@@ -0,0 +1,44 @@
+package websoc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientBadRequestsDoNotOpenBreaker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	client := NewClient(DefaultUserAgent)
+	for i := 0; i < failureThreshold+1; i++ {
+		if _, err := client.Get(server.URL); err == nil {
+			t.Fatal("Get of a 404 returned no error")
+		}
+	}
+	if status := client.Status(); status.State != Closed || status.ConsecutiveFailures != 0 {
+		t.Fatalf("after %v 404s the breaker is %v with %v failures; want closed with 0", failureThreshold+1, status.State, status.ConsecutiveFailures)
+	}
+}
+
+func TestClientUnavailableOpensBreaker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A pause longer than a retry is worth opens the breaker at once
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewClient(DefaultUserAgent)
+	if _, err := client.Get(server.URL); err == nil {
+		t.Fatal("Get of a 503 returned no error")
+	}
+	if status := client.Status(); status.State != Open {
+		t.Fatalf("after a 503 with Retry-After the breaker is %v; want open", status.State)
+	}
+	if _, err := client.Get(server.URL); err != ErrCircuitOpen {
+		t.Fatalf("Get while the breaker is open returned %v; want ErrCircuitOpen", err)
+	}
+}
@@ -0,0 +1,177 @@
+package websoc
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// SectionURL returns the WebSoc query URL that shows only the given course of the quarter.
+func SectionURL(quarter, courseCode string) string {
+	return "https://www.reg.uci.edu/perl/WebSoc?YearTerm=" + url.QueryEscape(quarter) + "&ShowFinals=0&ShowComments=0&CourseCodes=" + url.QueryEscape(courseCode)
+}
+
+// ErrSectionNotFound is returned by ParseSection when the page has no row for the course code.
+var ErrSectionNotFound = errors.New("websoc: section not found")
+
+// ErrUnexpectedPage is returned by ParseSection when the page has no header row of a table of sections,
+// such as a maintenance page or markup that changed, so that the course is not taken for one that does not exist.
+var ErrUnexpectedPage = errors.New("websoc: no table of sections in the page")
+
+// noCoursesMessage is what WebSoc shows instead of a table when no course matches the query.
+const noCoursesMessage = "No courses matched your search criteria"
+
+// Section is a row of the WebSoc schedule of classes.
+// Seat counts that WebSoc shows as n/a or leaves blank are -1.
+type Section struct {
+	Title      string
+	Code       string
+	Type       string
+	Section    string
+	Units      string
+	Instructor string
+	Time       string
+	Place      string
+	Max        int
+	Enrolled   int
+	Waitlist   int
+	Requested  int
+	NewOnly    int
+	Status     string
+}
+
+// ParseSection finds the row of the given course code in a WebSoc result page.
+// Columns are located by the headers of the table, so pages with or without finals both parse.
+// It returns ErrSectionNotFound when WebSoc lists no such course and ErrUnexpectedPage when the page has no table to look in.
+func ParseSection(body []byte, courseCode string) (*Section, error) {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	var title string
+	var columns map[string]int
+	for _, row := range findAll(doc, "tr") {
+		cells := children(row, "td", "th")
+		if len(cells) == 0 {
+			continue
+		}
+		if hasClass(cells[0], "CourseTitle") {
+			title = text(cells[0])
+			continue
+		}
+		if cells[0].Data == "th" {
+			columns = make(map[string]int)
+			for i, cell := range cells {
+				columns[text(cell)] = i
+			}
+			continue
+		}
+		if columns == nil || text(cells[0]) != courseCode {
+			continue
+		}
+
+		cell := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(cells) {
+				return ""
+			}
+			return text(cells[i])
+		}
+		return &Section{
+			Title:      title,
+			Code:       courseCode,
+			Type:       cell("Type"),
+			Section:    cell("Sec"),
+			Units:      cell("Units"),
+			Instructor: cell("Instructor"),
+			Time:       cell("Time"),
+			Place:      cell("Place"),
+			Max:        count(cell("Max")),
+			Enrolled:   count(cell("Enr")),
+			Waitlist:   count(cell("WL")),
+			Requested:  count(cell("Req")),
+			NewOnly:    count(cell("Nor")),
+			Status:     cell("Status"),
+		}, nil
+	}
+	if columns == nil && !bytes.Contains(body, []byte(noCoursesMessage)) {
+		return nil, ErrUnexpectedPage
+	}
+	return nil, ErrSectionNotFound
+}
+
+// count parses a seat count. Cross-listed sections show "section / total", of which the total is used.
+func count(value string) int {
+	if i := strings.LastIndex(value, "/"); i >= 0 {
+		value = value[i+1:]
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+func findAll(n *html.Node, tag string) []*html.Node {
+	var nodes []*html.Node
+	if n.Type == html.ElementNode && n.Data == tag {
+		nodes = append(nodes, n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		nodes = append(nodes, findAll(c, tag)...)
+	}
+	return nodes
+}
+
+func children(n *html.Node, tags ...string) []*html.Node {
+	var nodes []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		for _, tag := range tags {
+			if c.Data == tag {
+				nodes = append(nodes, c)
+			}
+		}
+	}
+	return nodes
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, attr := range n.Attr {
+		if attr.Key == "class" {
+			for _, c := range strings.Fields(attr.Val) {
+				if c == class {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// text returns the text content of a node as a browser shows it, with runs of whitespace collapsed;
+// strings.Fields also splits on &nbsp;. Inline elements such as links are not separated, but line breaks are.
+func text(n *html.Node) string {
+	var buffer bytes.Buffer
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			buffer.WriteString(n.Data)
+		}
+		if n.Type == html.ElementNode && n.Data == "br" {
+			buffer.WriteString(" ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	collect(n)
+	return strings.Join(strings.Fields(buffer.String()), " ")
+}
@@ -0,0 +1,69 @@
+package websoc
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func readPage(t *testing.T, name string) []byte {
+	body, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestParseSection(t *testing.T) {
+	tests := []struct {
+		code string
+		want Section
+	}{
+		{"34250", Section{
+			Title: "I&C SCI 32 PRG SOFTWARE LIB (Prerequisites)", Code: "34250", Type: "Lec", Section: "A", Units: "4",
+			Instructor: "PATTIS, R. STAFF", Time: "MWF 9:00- 9:50", Place: "SSLH 100",
+			Max: 300, Enrolled: 300, Waitlist: -1, Requested: 412, NewOnly: 0, Status: "OPEN",
+		}},
+		{"34251", Section{
+			Title: "I&C SCI 32 PRG SOFTWARE LIB (Prerequisites)", Code: "34251", Type: "Lab", Section: "1", Units: "0",
+			Instructor: "PATTIS, R.", Time: "MW 10:00-11:50", Place: "ICS 364",
+			Max: 50, Enrolled: 50, Waitlist: 12, Requested: 75, NewOnly: 0, Status: "Waitl",
+		}},
+		{"34252", Section{
+			Title: "I&C SCI 32 PRG SOFTWARE LIB (Prerequisites)", Code: "34252", Type: "Lab", Section: "2", Units: "0",
+			Instructor: "STAFF", Time: "TuTh 10:00-11:50", Place: "ICS 364",
+			Max: 50, Enrolled: 50, Waitlist: -1, Requested: 51, NewOnly: 0, Status: "FULL",
+		}},
+	}
+
+	// The Final column only shifts the columns after Place
+	for _, page := range []string{"section.html", "section_finals.html"} {
+		body := readPage(t, page)
+		for _, test := range tests {
+			section, err := ParseSection(body, test.code)
+			if err != nil {
+				t.Errorf("%v: ParseSection(%v) returned %v", page, test.code, err)
+				continue
+			}
+			if !reflect.DeepEqual(*section, test.want) {
+				t.Errorf("%v: ParseSection(%v) = %+v; want %+v", page, test.code, *section, test.want)
+			}
+		}
+	}
+}
+
+func TestParseSectionNotFound(t *testing.T) {
+	for _, page := range []string{"section.html", "no_courses.html"} {
+		if _, err := ParseSection(readPage(t, page), "99999"); err != ErrSectionNotFound {
+			t.Errorf("%v: ParseSection of a missing course returned %v; want ErrSectionNotFound", page, err)
+		}
+	}
+}
+
+func TestParseSectionUnexpectedPage(t *testing.T) {
+	// A page without a header row must not make every course look like it does not exist
+	if _, err := ParseSection(readPage(t, "maintenance.html"), "34250"); err != ErrUnexpectedPage {
+		t.Errorf("ParseSection of a maintenance page returned %v; want ErrUnexpectedPage", err)
+	}
+}